@@ -5,6 +5,8 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+
+	"github.com/codahale/http-handlers/logging"
 )
 
 // X509NameVerifier supports wrapping an http.Handler to check the contents
@@ -21,7 +23,8 @@ var dnRegexp *regexp.Regexp
 // If CheckCertificate returns true, the request will be passed to the wrapped
 // handler. If CheckCertificate returns false, it will be passed to the
 // InvalidHandler or, if no InvalidHandler is specified, will return an
-// empty 403 response and log the rejected DN.
+// empty 403 response and log the rejected DN. The common name of accepted
+// certificates is recorded as the authenticated user for request logs.
 func (v *X509NameVerifier) Wrap(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		dn := r.Header.Get(v.HeaderName)
@@ -32,6 +35,7 @@ func (v *X509NameVerifier) Wrap(h http.Handler) http.Handler {
 		}
 
 		if name != nil && v.CheckCertificate(name) {
+			logging.SetUser(r.Context(), name.CommonName)
 			h.ServeHTTP(w, r)
 		} else if v.InvalidHandler != nil {
 			v.InvalidHandler.ServeHTTP(w, r)
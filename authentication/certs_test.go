@@ -1,9 +1,14 @@
 package authentication
 
 import (
+	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/codahale/http-handlers/logging"
 )
 
 const (
@@ -69,3 +74,31 @@ func TestX509NameVerifier(t *testing.T) {
 		t.Errorf("Expected to receive a 404 from our custom handler, got %d", res.Code)
 	}
 }
+
+func TestX509NameVerifierLogsUser(t *testing.T) {
+	v := X509NameVerifier{
+		HeaderName:       testHeaderName,
+		CheckCertificate: RequireOU([]string{testOU}),
+	}
+
+	out := bytes.NewBuffer(nil)
+	logger := logging.Wrap(
+		v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(204)
+		})),
+		out,
+		logging.WithFormatter(logging.Common),
+	)
+	logger.Start()
+
+	hdr := http.Header{}
+	hdr.Set(testHeaderName, testDN+"/CN=client.example.com")
+
+	res := httptest.NewRecorder()
+	logger.ServeHTTP(res, &http.Request{Header: hdr, RemoteAddr: "203.0.113.1:5150"})
+	logger.Stop(context.Background())
+
+	if !strings.HasPrefix(out.String(), "203.0.113.1 - client.example.com [") {
+		t.Errorf("Unexpected log output: %q", out.String())
+	}
+}
@@ -0,0 +1,194 @@
+// Package clientip determines the IP addresses of HTTP clients, believing the
+// forwarding headers of trusted proxies and nobody else's.
+package clientip
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// A Resolver determines the IP address of the client which made a request.
+//
+// If the request came from a trusted proxy, the Resolver walks the forwarding
+// header which the proxy sets from right to left, skipping the addresses of other
+// trusted proxies, and returns the first untrusted address it finds. Because
+// each proxy appends the address it received the request from, everything to
+// the right of that address was written by a trusted proxy, and everything to
+// the left of it may have been forged by the client.
+//
+// Only one header is consulted, since proxies generally pass through the
+// forwarding headers they don't set themselves, and clients can set those to
+// anything.
+type Resolver struct {
+	// Trusted is the set of networks containing trusted proxies.
+	Trusted []*net.IPNet
+
+	// Header is the forwarding header which trusted proxies set, e.g.
+	// X-Forwarded-For. If empty, no proxies are trusted.
+	Header string
+}
+
+// NewResolver returns a Resolver which believes the given forwarding header
+// when it's set by proxies in the given networks, written either in CIDR
+// notation (e.g. "10.0.0.0/8") or as single IP addresses. The header may only
+// be empty if there are no trusted proxies.
+func NewResolver(header string, trusted ...string) (*Resolver, error) {
+	if header == "" && len(trusted) > 0 {
+		return nil, errNoHeader
+	}
+
+	r := &Resolver{Header: header}
+	for _, s := range trusted {
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		r.Trusted = append(r.Trusted, n)
+	}
+	return r, nil
+}
+
+var errNoHeader = errors.New("clientip: trusted proxies require a forwarding header")
+
+// MustResolver is like NewResolver but panics if the header is missing or a
+// network cannot be parsed.
+func MustResolver(header string, trusted ...string) *Resolver {
+	r, err := NewResolver(header, trusted...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Forwarding headers.
+const (
+	Forwarded     = "Forwarded"
+	XForwardedFor = "X-Forwarded-For"
+	XRealIP       = "X-Real-IP"
+)
+
+// ClientIP returns the IP address of the client which made the given request,
+// without a port or brackets.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	peer := host(req.RemoteAddr)
+	if r.Header == "" || !r.trusts(peer) {
+		return peer
+	}
+
+	name := http.CanonicalHeaderKey(r.Header)
+	values := req.Header[name]
+	if len(values) == 0 {
+		return peer
+	}
+
+	var hops []string
+	switch name {
+	case Forwarded:
+		hops = forwardedFor(values)
+	case http.CanonicalHeaderKey(XRealIP):
+		hops = values[len(values)-1:]
+	default:
+		hops = split(values)
+	}
+
+	return r.walk(peer, hops)
+}
+
+// walk returns the rightmost untrusted address in the given list of hops, or
+// the leftmost one if they're all trusted. If it runs into an address it can't
+// parse, such as an obfuscated identifier, it stops and returns the address of
+// the trusted proxy which added it.
+func (r *Resolver) walk(peer string, hops []string) string {
+	addr := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := host(hops[i])
+		if net.ParseIP(hop) == nil {
+			return addr
+		}
+
+		addr = hop
+		if !r.trusts(addr) {
+			return addr
+		}
+	}
+	return addr
+}
+
+func (r *Resolver) trusts(addr string) bool {
+	if len(r.Trusted) == 0 {
+		return false
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range r.Trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// split returns the comma-separated elements of all the given header values.
+func split(values []string) []string {
+	var elements []string
+	for _, v := range values {
+		for _, e := range strings.Split(v, ",") {
+			elements = append(elements, strings.TrimSpace(e))
+		}
+	}
+	return elements
+}
+
+// forwardedFor returns the for parameters of an RFC 7239 Forwarded header,
+// e.g. `for=192.0.2.43, for="[2001:db8:cafe::17]:4711";proto=https`.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, element := range split(values) {
+		// An element without a for parameter is still a hop, but an unknown
+		// one.
+		hop := ""
+		for _, pair := range strings.Split(element, ";") {
+			pair = strings.TrimSpace(pair)
+			if i := strings.IndexByte(pair, '='); i != -1 && strings.EqualFold(pair[:i], "for") {
+				hop = strings.Trim(pair[i+1:], `"`)
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// host returns the IP address part of an address with an optional port,
+// bracketed if it's an IPv6 address with a port. It doesn't allocate, so
+// resolving the address of a request from an untrusted peer is cheap.
+func host(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") {
+		if end := strings.IndexByte(s, ']'); end != -1 {
+			s = s[1:end]
+		}
+	} else if strings.Count(s, ":") == 1 {
+		s = s[:strings.IndexByte(s, ':')]
+	}
+
+	// Drop any IPv6 zone.
+	if i := strings.IndexByte(s, '%'); i != -1 {
+		s = s[:i]
+	}
+
+	return s
+}
@@ -0,0 +1,108 @@
+package clientip
+
+import (
+	"net/http"
+	"testing"
+)
+
+type clientIPTest struct {
+	remoteAddr string
+	headers    http.Header
+	expected   string
+}
+
+func testClientIP(t *testing.T, r *Resolver, tests []clientIPTest) {
+	for _, test := range tests {
+		req := &http.Request{RemoteAddr: test.remoteAddr, Header: test.headers}
+		if actual := r.ClientIP(req); actual != test.expected {
+			t.Errorf("%s %v was %s, but expected %s", test.remoteAddr, test.headers, actual, test.expected)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := MustResolver(XForwardedFor, "10.0.0.0/8", "::1", "2001:db8:ffff::/48")
+
+	testClientIP(t, r, []clientIPTest{
+		// untrusted peers can't forward
+		{"203.0.113.1:5150", nil, "203.0.113.1"},
+		{"203.0.113.1:5150", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.1"},
+		{"[2001:db8::1]:5150", nil, "2001:db8::1"},
+
+		// trusted peers without headers
+		{"10.0.0.1:5150", nil, "10.0.0.1"},
+
+		// right to left
+		{"10.0.0.1:5150", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"10.0.0.1:5150", http.Header{"X-Forwarded-For": {"6.6.6.6, 198.51.100.1, 10.0.0.2"}}, "198.51.100.1"},
+		{"10.0.0.1:5150", http.Header{"X-Forwarded-For": {"6.6.6.6", "198.51.100.1"}}, "198.51.100.1"},
+		{"10.0.0.1:5150", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"10.0.0.1:5150", http.Header{"X-Forwarded-For": {"6.6.6.6, garbage"}}, "10.0.0.1"},
+		{"10.0.0.1:5150", http.Header{"X-Forwarded-For": {"198.51.100.1:4711"}}, "198.51.100.1"},
+		{"10.0.0.1:5150", http.Header{"X-Forwarded-For": {"2001:db8::17"}}, "2001:db8::17"},
+		{"[::1]:5150", http.Header{"X-Forwarded-For": {"[2001:db8::17]:4711"}}, "2001:db8::17"},
+
+		// other headers are ignored
+		{"10.0.0.1:5150", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "10.0.0.1"},
+	})
+}
+
+func TestClientIPForwarded(t *testing.T) {
+	r := MustResolver(Forwarded, "10.0.0.0/8", "2001:db8:ffff::/48")
+
+	testClientIP(t, r, []clientIPTest{
+		{"10.0.0.1:5150", http.Header{"Forwarded": {`for=198.51.100.1;proto=https`}}, "198.51.100.1"},
+		{"10.0.0.1:5150", http.Header{"Forwarded": {`for=6.6.6.6, for="[2001:db8:cafe::17]:4711", for=10.0.0.2`}}, "2001:db8:cafe::17"},
+		{"10.0.0.1:5150", http.Header{"Forwarded": {`For="[2001:db8:ffff::1]";by=10.0.0.1`}}, "2001:db8:ffff::1"},
+		{"10.0.0.1:5150", http.Header{"Forwarded": {`for=6.6.6.6, for=_hidden, for=10.0.0.2`}}, "10.0.0.2"},
+		{"10.0.0.1:5150", http.Header{"Forwarded": {`for=6.6.6.6, proto=http`}}, "10.0.0.1"},
+	})
+}
+
+func TestClientIPRealIP(t *testing.T) {
+	r := MustResolver(XRealIP, "10.0.0.1")
+
+	testClientIP(t, r, []clientIPTest{
+		{"10.0.0.1:5150", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+	})
+}
+
+func TestClientIPInjectedHeader(t *testing.T) {
+	r := MustResolver(XForwardedFor, "10.0.0.0/8")
+
+	// The proxy appends to X-Forwarded-For, but passes through the
+	// client's own Forwarded header.
+	testClientIP(t, r, []clientIPTest{
+		{"10.0.0.1:5150", http.Header{
+			"Forwarded":       {"for=1.2.3.4"},
+			"X-Forwarded-For": {"203.0.113.7"},
+		}, "203.0.113.7"},
+	})
+}
+
+func TestClientIPWithoutHeader(t *testing.T) {
+	r, err := NewResolver("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testClientIP(t, r, []clientIPTest{
+		{"10.0.0.1:5150", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "10.0.0.1"},
+	})
+
+	// A Resolver built by hand without a header trusts nobody.
+	r = &Resolver{Trusted: MustResolver(XForwardedFor, "10.0.0.0/8").Trusted}
+	testClientIP(t, r, []clientIPTest{
+		{"10.0.0.1:5150", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "10.0.0.1"},
+	})
+}
+
+func TestNewResolverError(t *testing.T) {
+	if _, err := NewResolver(XForwardedFor, "10.0.0.0/33"); err == nil {
+		t.Error("Should have failed to parse an invalid network")
+	}
+
+	if _, err := NewResolver("", "10.0.0.0/8"); err == nil {
+		t.Error("Should have required a header")
+	}
+}
@@ -0,0 +1,239 @@
+// Command logreplay replays access logs written by logging.LoggingHandler in
+// the Combined or Common formats against another server, preserving the timing
+// of the original requests, and reports how the responses differed:
+//
+//	logreplay -target http://localhost:8080 -speed 2 access.log
+//
+// Requests are replayed with their original methods, URIs, user agents,
+// referers and request IDs, but without bodies, which aren't logged. With a
+// speed of 2 requests are replayed twice as fast as they were received, and
+// with a speed of 0 as fast as the concurrency limit allows.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codahale/http-handlers/logging"
+)
+
+func main() {
+	var (
+		target      = flag.String("target", "", "the base URL to replay requests against")
+		speed       = flag.Float64("speed", 1, "the speed to replay requests at, relative to the original timing; 0 for no delays")
+		concurrency = flag.Int("concurrency", 10, "the maximum number of requests in flight")
+		timeout     = flag.Duration("timeout", 30*time.Second, "the timeout for each request")
+	)
+	flag.Parse()
+
+	if *target == "" || *concurrency < 1 || *speed < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rp := &replayer{
+		client: &http.Client{
+			Timeout: *timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		target:      strings.TrimRight(*target, "/"),
+		speed:       *speed,
+		concurrency: *concurrency,
+	}
+
+	var r io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		var readers []io.Reader
+		for _, name := range flag.Args() {
+			f, err := os.Open(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			readers = append(readers, f)
+		}
+		r = io.MultiReader(readers...)
+	}
+
+	rep, err := rp.replay(r)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rep.write(os.Stdout)
+}
+
+type replayer struct {
+	client      *http.Client
+	target      string
+	speed       float64
+	concurrency int
+}
+
+// replay replays the requests logged in r, returning a report once every
+// response has been received.
+func (rp *replayer) replay(r io.Reader) (*report, error) {
+	var (
+		rep     = &report{statuses: make(map[[2]int]int)}
+		wg      sync.WaitGroup
+		slots   = make(chan struct{}, rp.concurrency)
+		first   time.Time
+		started time.Time
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		e, err := logging.ParseCombined(scanner.Text())
+		if err != nil {
+			rep.add(result{unparseable: true})
+			continue
+		}
+
+		if started.IsZero() {
+			first, started = e.Start, time.Now()
+		}
+
+		if rp.speed > 0 {
+			due := started.Add(time.Duration(float64(e.Start.Sub(first)) / rp.speed))
+			time.Sleep(time.Until(due))
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rep.add(rp.send(e))
+			<-slots
+		}()
+	}
+	wg.Wait()
+
+	return rep, scanner.Err()
+}
+
+// send replays a single request.
+func (rp *replayer) send(e *logging.Entry) result {
+	res := result{original: e.Status, originalLatency: e.Duration}
+
+	req, err := http.NewRequest(e.Method, rp.target+e.RequestURI, nil)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	if e.UserAgent != "" {
+		req.Header.Set("User-Agent", e.UserAgent)
+	}
+	if e.Referer != "" {
+		req.Header.Set("Referer", e.Referer)
+	}
+	if e.RequestID != "" {
+		req.Header.Set("X-Request-Id", e.RequestID)
+	}
+
+	start := time.Now()
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	res.status = resp.StatusCode
+	res.latency = time.Since(start)
+	return res
+}
+
+type result struct {
+	unparseable     bool
+	err             error
+	original        int
+	status          int
+	originalLatency time.Duration
+	latency         time.Duration
+}
+
+type report struct {
+	m           sync.Mutex
+	requests    int
+	unparseable int
+	errors      int
+	statuses    map[[2]int]int // original and replayed statuses which differed
+	original    []time.Duration
+	replayed    []time.Duration
+}
+
+func (rep *report) add(res result) {
+	rep.m.Lock()
+	defer rep.m.Unlock()
+
+	switch {
+	case res.unparseable:
+		rep.unparseable++
+		return
+	case res.err != nil:
+		rep.requests++
+		rep.errors++
+		return
+	}
+
+	rep.requests++
+	if res.status != res.original {
+		rep.statuses[[2]int{res.original, res.status}]++
+	}
+	rep.original = append(rep.original, res.originalLatency)
+	rep.replayed = append(rep.replayed, res.latency)
+}
+
+func (rep *report) write(w io.Writer) {
+	fmt.Fprintf(w, "Replayed %d requests (%d errors, %d unparseable lines)\n",
+		rep.requests, rep.errors, rep.unparseable)
+
+	if len(rep.statuses) > 0 {
+		var diffs [][2]int
+		for diff := range rep.statuses {
+			diffs = append(diffs, diff)
+		}
+		sort.Slice(diffs, func(i, j int) bool {
+			if diffs[i][0] != diffs[j][0] {
+				return diffs[i][0] < diffs[j][0]
+			}
+			return diffs[i][1] < diffs[j][1]
+		})
+
+		fmt.Fprintf(w, "\nStatus differences:\n")
+		for _, diff := range diffs {
+			fmt.Fprintf(w, "  %d -> %d  %d\n", diff[0], diff[1], rep.statuses[diff])
+		}
+	}
+
+	if len(rep.replayed) > 0 {
+		fmt.Fprintf(w, "\nLatency (ms)      p50       p90       p99       max\n")
+		writeLatencies(w, "original", rep.original)
+		writeLatencies(w, "replayed", rep.replayed)
+	}
+}
+
+func writeLatencies(w io.Writer, name string, latencies []time.Duration) {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Fprintf(w, "%-10s", name)
+	for _, q := range []float64{0.5, 0.9, 0.99, 1} {
+		d := latencies[int(q*float64(len(latencies)-1))]
+		fmt.Fprintf(w, "%10.1f", float64(d)/float64(time.Millisecond))
+	}
+	fmt.Fprintln(w)
+}
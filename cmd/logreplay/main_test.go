@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	var (
+		ids   []string
+		agent string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get("X-Request-Id"))
+		agent = r.UserAgent()
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	log := strings.Join([]string{
+		`203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13 "-" "gotest" 1007 "req1"`,
+		`not a log line`,
+		`203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET /gone?x=1 HTTP/1.1" 200 13 "-" "gotest" 3 "req2"`,
+	}, "\n")
+
+	rp := &replayer{
+		client:      server.Client(),
+		target:      server.URL,
+		speed:       1,
+		concurrency: 1,
+	}
+
+	rep, err := rp.replay(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(ids, ",") != "req1,req2" || agent != "gotest" {
+		t.Errorf("Replayed %v with %q", ids, agent)
+	}
+
+	w := bytes.NewBuffer(nil)
+	rep.write(w)
+
+	lines := strings.Split(w.String(), "\n")
+	expected := []string{
+		"Replayed 2 requests (0 errors, 1 unparseable lines)",
+		"",
+		"Status differences:",
+		"  200 -> 404  1",
+		"",
+		"Latency (ms)      p50       p90       p99       max",
+		"original         3.0       3.0       3.0    1007.0",
+	}
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Errorf("Line %d was %q, but expected %q", i, lines[i], line)
+		}
+	}
+}
+
+func TestReplayTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	log := `203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 0
+203.0.113.1 - - [03/Jun/2014:16:45:23 +0000] "GET / HTTP/1.1" 200 0
+`
+
+	rp := &replayer{
+		client:      server.Client(),
+		target:      server.URL,
+		speed:       4,
+		concurrency: 1,
+	}
+
+	start := time.Now()
+	if _, err := rp.replay(strings.NewReader(log)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second apart, four times faster.
+	if d := time.Since(start); d < 250*time.Millisecond || d > time.Second {
+		t.Errorf("Replay took %s, but expected about 250ms", d)
+	}
+}
@@ -15,14 +15,26 @@ import (
 	"time"
 )
 
-// Wrap returns a handler which adds the following URLs as special cases:
+// An Endpoint is an additional debug endpoint.
+type Endpoint struct {
+	Path    string
+	Handler http.Handler
+}
+
+// Wrap returns a handler which adds the following URLs as special cases, along
+// with any additional endpoints:
 //
 //     /debug/pprof/        -- an HTML index of pprof endpoints
 //     /debug/pprof/cmdline -- the running process's command line
 //     /debug/pprof/profile -- pprof profiling endpoint
 //     /debug/pprof/symbol  -- pprof debugging symbols
 //     /debug/vars          -- JSON-formatted expvars
-func Wrap(handler http.Handler) http.Handler {
+//
+// For example, to stream the access log of a LoggingHandler configured with
+// logging.WithTail(tail) from /debug/logs:
+//
+//     debug.Wrap(h, debug.Endpoint{Path: "/debug/logs", Handler: tail})
+func Wrap(handler http.Handler, endpoints ...Endpoint) http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
 	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
@@ -31,6 +43,9 @@ func Wrap(handler http.Handler) http.Handler {
 	mux.HandleFunc("/debug/pprof/block", blockHandler)
 	mux.HandleFunc("/debug/vars", expvarHandler)
 	mux.HandleFunc("/debug/gc", performGC)
+	for _, e := range endpoints {
+		mux.Handle(e.Path, e.Handler)
+	}
 	mux.Handle("/", handler)
 	return mux
 }
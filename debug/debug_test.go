@@ -130,3 +130,21 @@ func newDebugServer() *httptest.Server {
 func helloWorld(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "Hello, world!")
 }
+
+func TestEndpoints(t *testing.T) {
+	server := httptest.NewServer(Wrap(http.HandlerFunc(helloWorld), Endpoint{
+		Path: "/debug/extra",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "extra")
+		}),
+	}))
+	defer server.Close()
+
+	if resp := get200(t, server.URL+"/debug/extra"); resp != "extra\n" {
+		t.Errorf("Unknown response:\n%s", resp)
+	}
+
+	if resp := get200(t, server.URL+"/"); resp != "Hello, world!\n" {
+		t.Errorf("Unknown response:\n%s", resp)
+	}
+}
@@ -0,0 +1,126 @@
+// Package response provides the ResponseWriter wrapper shared by the logging
+// and metrics handlers.
+package response
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// A Recorder records the status and size of a response while passing through
+// the optional interfaces of the underlying ResponseWriter.
+type Recorder struct {
+	w      http.ResponseWriter
+	status int
+	size   int64
+}
+
+// NewRecorder returns a Recorder which wraps the given ResponseWriter.
+func NewRecorder(w http.ResponseWriter) Recorder {
+	return Recorder{w: w}
+}
+
+// Status returns the response's status code, which is 200 unless the handler
+// wrote a different one.
+func (r *Recorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Size returns the number of bytes of the response body written so far.
+func (r *Recorder) Size() int64 {
+	return r.size
+}
+
+func (r *Recorder) Header() http.Header {
+	return r.w.Header()
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	r.implicitOK()
+	n, err := r.w.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *Recorder) WriteHeader(status int) {
+	// Informational responses other than 101 are followed by the real one.
+	if r.status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		r.status = status
+	}
+	r.w.WriteHeader(status)
+}
+
+// ReadFrom allows the underlying ResponseWriter to use sendfile(2) if it
+// supports it.
+func (r *Recorder) ReadFrom(src io.Reader) (int64, error) {
+	r.implicitOK()
+	var (
+		n   int64
+		err error
+	)
+	if rf, ok := r.w.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(r.w, src)
+	}
+	r.size += n
+	return n, err
+}
+
+func (r *Recorder) Flush() {
+	if flusher, ok := r.w.(http.Flusher); ok {
+		r.implicitOK()
+		flusher.Flush()
+	}
+}
+
+func (r *Recorder) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := r.w.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// CloseNotify returns the underlying ResponseWriter's close notification
+// channel, or a channel which never receives if it has none.
+func (r *Recorder) CloseNotify() <-chan bool {
+	if notifier, ok := r.w.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// Hijack hijacks the underlying connection. Since the handler is taking over
+// the connection, usually to switch protocols, a response without a status is
+// recorded as 101 Switching Protocols.
+func (r *Recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http-handlers: underlying ResponseWriter does not implement http.Hijacker")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.w
+}
+
+// implicitOK records the implicit 200 of a response whose body is written
+// without a status.
+func (r *Recorder) implicitOK() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+}
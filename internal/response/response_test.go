@@ -0,0 +1,95 @@
+package response
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecorderStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		f        func(w http.ResponseWriter)
+		expected int
+	}{
+		{"nothing", func(w http.ResponseWriter) {}, 200},
+		{"write", func(w http.ResponseWriter) { _, _ = w.Write([]byte("ok")) }, 200},
+		{"header", func(w http.ResponseWriter) { w.WriteHeader(404) }, 404},
+		{"informational", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusCreated)
+		}, 201},
+		{"late header", func(w http.ResponseWriter) {
+			_, _ = w.Write([]byte("ok"))
+			w.WriteHeader(500)
+		}, 200},
+		{"flush", func(w http.ResponseWriter) { w.(http.Flusher).Flush() }, 200},
+	}
+
+	for _, test := range tests {
+		rec := NewRecorder(httptest.NewRecorder())
+		test.f(&rec)
+		if v := rec.Status(); v != test.expected {
+			t.Errorf("%s: status was %d, but expected %d", test.name, v, test.expected)
+		}
+	}
+}
+
+func TestRecorderPassThrough(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := NewRecorder(w)
+
+	if _, err := rec.ReadFrom(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rec.Write([]byte(", world")); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Body.String() != "hello, world" {
+		t.Errorf("Body was %q", w.Body.String())
+	}
+
+	if rec.Size() != 12 {
+		t.Errorf("Size was %d, but expected 12", rec.Size())
+	}
+
+	if _, _, err := rec.Hijack(); err == nil {
+		t.Error("A recorder can't be hijacked")
+	}
+
+	if err := rec.Push("/app.js", nil); err != http.ErrNotSupported {
+		t.Errorf("Push returned %v, but expected ErrNotSupported", err)
+	}
+
+	if rec.CloseNotify() == nil {
+		t.Error("CloseNotify should return a channel")
+	}
+
+	if http.NewResponseController(&rec).Flush() != nil {
+		t.Error("Flush should pass through")
+	}
+}
+
+type hijackable struct {
+	*httptest.ResponseRecorder
+}
+
+func (hijackable) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func TestRecorderHijack(t *testing.T) {
+	rec := NewRecorder(hijackable{httptest.NewRecorder()})
+	if _, _, err := rec.Hijack(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := rec.Status(); v != http.StatusSwitchingProtocols {
+		t.Errorf("Status was %d, but expected 101", v)
+	}
+}
@@ -0,0 +1,605 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CompileFormat compiles an Apache mod_log_config format string, such as
+//
+//	%h %l %u %t "%r" %>s %b %D %{X-Request-Id}i %{Content-Type}o
+//
+// into a Formatter. The following directives are supported:
+//
+//	%%          a literal percent sign
+//	%a          the client's IP address; %{c}a is the peer's IP address
+//	%A          the local IP address
+//	%B          the size of the response body in bytes
+//	%b          as %B, but "-" rather than 0
+//	%{name}C    the value of the named request cookie
+//	%D          the time taken to serve the request, in microseconds
+//	%{name}e    the value of the named field added with AddField
+//	%h          the client's IP address
+//	%H          the request protocol
+//	%{name}i    the value of the named request header
+//	%k          the number of earlier requests served over the connection
+//	%l          the remote logname, which is always "-"
+//	%L          the request ID
+//	%m          the request method
+//	%{name}o    the value of the named response header
+//	%p          the local port; %{local}p, %{remote}p and %{canonical}p
+//	%P          the process ID
+//	%q          the query string, prefixed with "?" if not empty
+//	%r          the first line of the request
+//	%s, %>s     the response status
+//	%t          the time the request was received, in Apache's format
+//	%{format}t  the time in the given strftime format, or one of sec, msec,
+//	            usec, msec_frac or usec_frac; prefix with end: for the time the
+//	            response finished
+//	%T          the time taken to serve the request, in seconds; %{ms}T and
+//	            %{us}T in milliseconds and microseconds
+//	%u          the authenticated user
+//	%U          the URL path requested, without the query string
+//	%v, %V      the server name from the request's Host header
+//	%{var}x     the TLS details of the connection, where var is one of
+//	            SSL_PROTOCOL, SSL_CIPHER, SSL_TLS_SNI, SSL_ALPN or
+//	            SSL_CLIENT_S_DN
+//
+// %k and %x require WithConnInfo. Directives may be restricted to responses
+// with particular status codes, as in %400,501{User-agent}i or
+// %!200,304{Referer}i, and the < and > modifiers are accepted but ignored.
+// Missing values are logged as "-", and non-printable characters, quotes and
+// backslashes in request data are escaped.
+func CompileFormat(format string) (Formatter, error) {
+	var (
+		f       apacheFormatter
+		literal []byte
+	)
+
+	for i := 0; i < len(format); {
+		if format[i] != '%' {
+			literal = append(literal, format[i])
+			i++
+			continue
+		}
+
+		start := i
+		i++
+		if i < len(format) && format[i] == '%' {
+			literal = append(literal, '%')
+			i++
+			continue
+		}
+
+		var (
+			arg    string
+			codes  []int
+			negate bool
+		)
+	modifiers:
+		for ; i < len(format); i++ {
+			switch c := format[i]; {
+			case c == '<' || c == '>' || c == ',':
+			case c == '!':
+				negate = true
+			case c >= '0' && c <= '9':
+				j := i
+				for j < len(format) && format[j] >= '0' && format[j] <= '9' {
+					j++
+				}
+				code, _ := strconv.Atoi(format[i:j])
+				codes = append(codes, code)
+				i = j - 1
+			case c == '{':
+				end := strings.IndexByte(format[i:], '}')
+				if end == -1 {
+					return nil, formatError(format, start, "unterminated {")
+				}
+				arg = format[i+1 : i+end]
+				i += end
+			default:
+				break modifiers
+			}
+		}
+
+		if i == len(format) {
+			return nil, formatError(format, start, "incomplete directive")
+		}
+
+		d, err := compileDirective(format[i], arg)
+		if err != nil {
+			return nil, formatError(format, start, err.Error())
+		}
+		i++
+
+		if len(codes) > 0 {
+			d = conditional(d, codes, negate)
+		}
+
+		if len(literal) > 0 {
+			f = append(f, literalDirective(string(literal)))
+			literal = literal[:0]
+		}
+		f = append(f, d)
+	}
+
+	if len(literal) > 0 {
+		f = append(f, literalDirective(string(literal)))
+	}
+
+	return f, nil
+}
+
+// MustCompileFormat is like CompileFormat but panics if the format cannot be
+// compiled.
+func MustCompileFormat(format string) Formatter {
+	f, err := CompileFormat(format)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// WithFormat returns an Option which formats log entries using the given
+// Apache mod_log_config format string. It panics if the format cannot be
+// compiled; use CompileFormat and WithFormatter to handle the error instead.
+func WithFormat(format string) Option {
+	return WithFormatter(MustCompileFormat(format))
+}
+
+func formatError(format string, offset int, msg string) error {
+	return fmt.Errorf("logging: %s at offset %d in format %q", msg, offset, format)
+}
+
+type directive func(b []byte, e *Entry) []byte
+
+type apacheFormatter []directive
+
+func (f apacheFormatter) Format(b []byte, e *Entry) []byte {
+	for _, d := range f {
+		b = d(b, e)
+	}
+	return append(b, '\n')
+}
+
+func literalDirective(s string) directive {
+	return func(b []byte, _ *Entry) []byte {
+		return append(b, s...)
+	}
+}
+
+func conditional(d directive, codes []int, negate bool) directive {
+	return func(b []byte, e *Entry) []byte {
+		match := false
+		for _, code := range codes {
+			if e.Status == code {
+				match = true
+				break
+			}
+		}
+		if match == negate {
+			return append(b, '-')
+		}
+		return d(b, e)
+	}
+}
+
+func compileDirective(c byte, arg string) (directive, error) {
+	switch c {
+	case 'a':
+		if arg == "c" {
+			return requestDirective(func(b []byte, r *http.Request) []byte {
+				return appendEscaped(b, stripPort(r.RemoteAddr))
+			}), nil
+		}
+		return remoteAddrDirective, nil
+	case 'A':
+		return requestDirective(func(b []byte, r *http.Request) []byte {
+			addr, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+			if addr == nil {
+				return append(b, '-')
+			}
+			return appendEscaped(b, stripPort(addr.String()))
+		}), nil
+	case 'B':
+		return func(b []byte, e *Entry) []byte {
+			return strconv.AppendInt(b, e.Size, 10)
+		}, nil
+	case 'b':
+		return func(b []byte, e *Entry) []byte {
+			if e.Size == 0 {
+				return append(b, '-')
+			}
+			return strconv.AppendInt(b, e.Size, 10)
+		}, nil
+	case 'C':
+		if arg == "" {
+			return nil, errors.New("missing cookie name")
+		}
+		return requestDirective(func(b []byte, r *http.Request) []byte {
+			c, err := r.Cookie(arg)
+			if err != nil {
+				return append(b, '-')
+			}
+			return appendEscaped(b, c.Value)
+		}), nil
+	case 'D':
+		return func(b []byte, e *Entry) []byte {
+			return strconv.AppendInt(b, int64(e.Duration/time.Microsecond), 10)
+		}, nil
+	case 'e':
+		if arg == "" {
+			return nil, errors.New("missing field name")
+		}
+		return func(b []byte, e *Entry) []byte {
+			for _, f := range e.Fields {
+				if f.Key == arg {
+					return appendEscaped(b, f.Value)
+				}
+			}
+			return append(b, '-')
+		}, nil
+	case 'h':
+		return remoteAddrDirective, nil
+	case 'H':
+		return func(b []byte, e *Entry) []byte {
+			return appendEscaped(b, e.Proto)
+		}, nil
+	case 'i':
+		if arg == "" {
+			return nil, errors.New("missing header name")
+		}
+		name := http.CanonicalHeaderKey(arg)
+		switch name {
+		case "Referer":
+			return func(b []byte, e *Entry) []byte {
+				return appendEscaped(b, e.Referer)
+			}, nil
+		case "User-Agent":
+			return func(b []byte, e *Entry) []byte {
+				return appendEscaped(b, e.UserAgent)
+			}, nil
+		}
+		return requestDirective(func(b []byte, r *http.Request) []byte {
+			return appendEscaped(b, strings.Join(r.Header[name], ", "))
+		}), nil
+	case 'k':
+		return func(b []byte, e *Entry) []byte {
+			if e.Conn.Requests == 0 {
+				return append(b, '0')
+			}
+			return strconv.AppendInt(b, e.Conn.Requests-1, 10)
+		}, nil
+	case 'l':
+		return literalDirective("-"), nil
+	case 'L':
+		return func(b []byte, e *Entry) []byte {
+			return appendEscaped(b, e.RequestID)
+		}, nil
+	case 'm':
+		return func(b []byte, e *Entry) []byte {
+			return appendEscaped(b, e.Method)
+		}, nil
+	case 'o':
+		if arg == "" {
+			return nil, errors.New("missing header name")
+		}
+		name := http.CanonicalHeaderKey(arg)
+		return func(b []byte, e *Entry) []byte {
+			return appendEscaped(b, strings.Join(e.ResponseHeader[name], ", "))
+		}, nil
+	case 'p':
+		return compilePort(arg)
+	case 'P':
+		if arg != "" && arg != "pid" {
+			return nil, fmt.Errorf("unsupported process ID format %q", arg)
+		}
+		return literalDirective(strconv.Itoa(os.Getpid())), nil
+	case 'q':
+		return func(b []byte, e *Entry) []byte {
+			if i := strings.IndexByte(e.RequestURI, '?'); i != -1 && i < len(e.RequestURI)-1 {
+				return appendEscapedBytes(b, e.RequestURI[i:])
+			}
+			return b
+		}, nil
+	case 'r':
+		return func(b []byte, e *Entry) []byte {
+			b = appendEscapedBytes(b, e.Method)
+			b = append(b, ' ')
+			b = appendEscapedBytes(b, e.RequestURI)
+			b = append(b, ' ')
+			return appendEscapedBytes(b, e.Proto)
+		}, nil
+	case 's':
+		return func(b []byte, e *Entry) []byte {
+			return strconv.AppendInt(b, int64(e.Status), 10)
+		}, nil
+	case 't':
+		return compileTime(arg)
+	case 'T':
+		var unit time.Duration
+		switch arg {
+		case "", "s":
+			unit = time.Second
+		case "ms":
+			unit = time.Millisecond
+		case "us":
+			unit = time.Microsecond
+		default:
+			return nil, fmt.Errorf("unsupported time unit %q", arg)
+		}
+		return func(b []byte, e *Entry) []byte {
+			return strconv.AppendInt(b, int64(e.Duration/unit), 10)
+		}, nil
+	case 'u':
+		return func(b []byte, e *Entry) []byte {
+			return appendEscaped(b, e.User)
+		}, nil
+	case 'U':
+		return func(b []byte, e *Entry) []byte {
+			uri := e.RequestURI
+			if i := strings.IndexByte(uri, '?'); i != -1 {
+				uri = uri[:i]
+			}
+			return appendEscaped(b, uri)
+		}, nil
+	case 'v', 'V':
+		return requestDirective(func(b []byte, r *http.Request) []byte {
+			return appendEscaped(b, stripPort(r.Host))
+		}), nil
+	case 'x':
+		return compileTLS(arg)
+	}
+	return nil, fmt.Errorf("unsupported directive %%%c", c)
+}
+
+func remoteAddrDirective(b []byte, e *Entry) []byte {
+	return appendEscaped(b, e.RemoteAddr)
+}
+
+// requestDirective returns a directive which logs "-" for entries without a
+// request.
+func requestDirective(f func(b []byte, r *http.Request) []byte) directive {
+	return func(b []byte, e *Entry) []byte {
+		if e.Request == nil {
+			return append(b, '-')
+		}
+		return f(b, e.Request)
+	}
+}
+
+func compileTLS(arg string) (directive, error) {
+	var field func(c *ConnInfo) string
+	switch arg {
+	case "SSL_PROTOCOL":
+		field = func(c *ConnInfo) string { return c.TLSVersion }
+	case "SSL_CIPHER":
+		field = func(c *ConnInfo) string { return c.CipherSuite }
+	case "SSL_TLS_SNI":
+		field = func(c *ConnInfo) string { return c.ServerName }
+	case "SSL_ALPN":
+		field = func(c *ConnInfo) string { return c.ALPN }
+	case "SSL_CLIENT_S_DN":
+		field = func(c *ConnInfo) string { return c.ClientCert }
+	default:
+		return nil, fmt.Errorf("unsupported variable %q", arg)
+	}
+	return func(b []byte, e *Entry) []byte {
+		return appendEscaped(b, field(&e.Conn))
+	}, nil
+}
+
+func compilePort(arg string) (directive, error) {
+	switch arg {
+	case "", "canonical", "local":
+		return requestDirective(func(b []byte, r *http.Request) []byte {
+			addr, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+			if addr == nil {
+				return append(b, '-')
+			}
+			return appendEscaped(b, port(addr.String()))
+		}), nil
+	case "remote":
+		return requestDirective(func(b []byte, r *http.Request) []byte {
+			return appendEscaped(b, port(r.RemoteAddr))
+		}), nil
+	}
+	return nil, fmt.Errorf("unsupported port format %q", arg)
+}
+
+func compileTime(arg string) (directive, error) {
+	end := false
+	if strings.HasPrefix(arg, "end:") {
+		arg, end = arg[len("end:"):], true
+	} else {
+		arg = strings.TrimPrefix(arg, "begin:")
+	}
+
+	when := func(e *Entry) time.Time {
+		if end {
+			return e.Start.Add(e.Duration).In(time.UTC)
+		}
+		return e.Start.In(time.UTC)
+	}
+
+	switch arg {
+	case "":
+		return func(b []byte, e *Entry) []byte {
+			b = append(b, '[')
+			b = when(e).AppendFormat(b, apacheFormat)
+			return append(b, ']')
+		}, nil
+	case "sec":
+		return func(b []byte, e *Entry) []byte {
+			return strconv.AppendInt(b, when(e).Unix(), 10)
+		}, nil
+	case "msec":
+		return func(b []byte, e *Entry) []byte {
+			return strconv.AppendInt(b, when(e).UnixNano()/int64(time.Millisecond), 10)
+		}, nil
+	case "usec":
+		return func(b []byte, e *Entry) []byte {
+			return strconv.AppendInt(b, when(e).UnixNano()/int64(time.Microsecond), 10)
+		}, nil
+	case "msec_frac":
+		return func(b []byte, e *Entry) []byte {
+			return appendPadded(b, when(e).Nanosecond()/int(time.Millisecond), 3)
+		}, nil
+	case "usec_frac":
+		return func(b []byte, e *Entry) []byte {
+			return appendPadded(b, when(e).Nanosecond()/int(time.Microsecond), 6)
+		}, nil
+	}
+
+	parts, err := strftime(arg)
+	if err != nil {
+		return nil, err
+	}
+	return func(b []byte, e *Entry) []byte {
+		t := when(e)
+		for _, p := range parts {
+			if p.layout == "" {
+				b = append(b, p.literal...)
+			} else {
+				b = t.AppendFormat(b, p.layout)
+			}
+		}
+		return b
+	}, nil
+}
+
+// A timePart is either a time layout or literal text, which is kept apart from
+// the layouts so that e.g. a 1 isn't taken for the month.
+type timePart struct {
+	layout, literal string
+}
+
+// strftime converts a strftime(3) format into time layouts and literal text.
+func strftime(format string) ([]timePart, error) {
+	var (
+		parts   []timePart
+		literal []byte
+	)
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal = append(literal, format[i])
+			continue
+		}
+
+		i++
+		if i == len(format) {
+			return nil, errors.New("incomplete time format")
+		}
+
+		if s, ok := strftimeLiterals[format[i]]; ok {
+			literal = append(literal, s...)
+			continue
+		}
+
+		layout, ok := strftimeLayouts[format[i]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported time format %%%c", format[i])
+		}
+		if len(literal) > 0 {
+			parts = append(parts, timePart{literal: string(literal)})
+			literal = literal[:0]
+		}
+		parts = append(parts, timePart{layout: layout})
+	}
+	if len(literal) > 0 {
+		parts = append(parts, timePart{literal: string(literal)})
+	}
+	return parts, nil
+}
+
+var strftimeLiterals = map[byte]string{
+	'n': "\n",
+	't': "\t",
+	'%': "%",
+}
+
+var strftimeLayouts = map[byte]string{
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'B': "January",
+	'd': "02",
+	'D': "01/02/06",
+	'e': "_2",
+	'F': "2006-01-02",
+	'h': "Jan",
+	'H': "15",
+	'I': "03",
+	'j': "002",
+	'm': "01",
+	'M': "04",
+	'p': "PM",
+	'R': "15:04",
+	'S': "05",
+	'T': "15:04:05",
+	'y': "06",
+	'Y': "2006",
+	'z': "-0700",
+	'Z': "MST",
+}
+
+func appendPadded(b []byte, n, width int) []byte {
+	s := strconv.Itoa(n)
+	for i := len(s); i < width; i++ {
+		b = append(b, '0')
+	}
+	return append(b, s...)
+}
+
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func port(addr string) string {
+	_, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return p
+}
+
+// appendEscaped appends s as Apache would log it, or "-" if s is empty.
+func appendEscaped(b []byte, s string) []byte {
+	if s == "" {
+		return append(b, '-')
+	}
+	return appendEscapedBytes(b, s)
+}
+
+// appendEscapedBytes appends s, escaping quotes, backslashes, and
+// non-printable bytes as Apache does.
+func appendEscapedBytes(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		default:
+			if c < 0x20 || c >= 0x7f {
+				b = append(b, '\\', 'x', hex[c>>4], hex[c&0xf])
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return b
+}
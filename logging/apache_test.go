@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func apacheEntry() *Entry {
+	r := httptest.NewRequest("GET", "/search?q=a%20b", nil)
+	r.RemoteAddr = "203.0.113.1:5150"
+	r.Header.Set("X-Request-Id", "req12345")
+	r.Header.Set("X-Weird", "a\"b\\c\x01")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "s3cr3t"})
+
+	e := testEntry()
+	e.RequestURI = r.RequestURI
+	e.User = "coda"
+	e.Request = r
+	e.ResponseHeader = http.Header{"Content-Type": {"text/plain"}}
+	e.Fields = []Field{{Key: "tenant", Value: "acme corp"}}
+	e.Conn = ConnInfo{TLSVersion: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256", ALPN: "h2", Requests: 3}
+	return e
+}
+
+func TestCompileFormat(t *testing.T) {
+	f, err := CompileFormat(`%h %l %u %t "%r" %>s %b %D %{X-Request-Id}i %{Content-Type}o`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := string(f.Format(nil, apacheEntry()))
+	expected := `203.0.113.1 - coda [03/Jun/2014:16:45:22 +0000] "GET /search?q=a%20b HTTP/1.1" 200 13 1007000 req12345 text/plain` + "\n"
+	if actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+}
+
+func TestCompileFormatDirectives(t *testing.T) {
+	e := apacheEntry()
+	e.Size = 0
+
+	tests := map[string]string{
+		`%%`:                      `%`,
+		`%{c}a %{remote}p`:        `203.0.113.1 5150`,
+		`%B %b`:                   `0 -`,
+		`%{session}C %{nope}C`:    `s3cr3t -`,
+		`%H %m %L`:                `HTTP/1.1 GET req12345`,
+		`%{X-Weird}i`:             `a\"b\\c\x01`,
+		`%{User-Agent}i`:          `gotest \"quoted\"`,
+		`%{Referer}i %{Foo}o`:     `- -`,
+		`%U%q`:                    `/search?q=a%20b`,
+		`%v`:                      `example.com`,
+		`%T %{ms}T %{us}T`:        `1 1007 1007000`,
+		`%{sec}t`:                 `1401813922`,
+		`%{msec}t`:                `1401813922036`,
+		`%{end:msec_frac}t`:       `043`,
+		`%{usec_frac}t`:           `036000`,
+		`%{%Y-%m-%dT%H:%M:%S}t`:   `2014-06-03T16:45:22`,
+		`%{%Y 1 Jan Mon PM MST}t`: `2014 1 Jan Mon PM MST`,
+		`%{%H%%%M at 15}t`:        `16%45 at 15`,
+		`%200{Referer}i`:          `-`,
+		`%!200{X-Request-Id}i`:    `-`,
+		`%200,304{X-Request-Id}i`: `req12345`,
+		`%<s %>s`:                 `200 200`,
+		`%{tenant}e %{cache}e`:    `acme corp -`,
+		`%k`:                      `2`,
+		`%{SSL_PROTOCOL}x %{SSL_CIPHER}x %{SSL_ALPN}x %{SSL_TLS_SNI}x`: `TLS 1.3 TLS_AES_128_GCM_SHA256 h2 -`,
+	}
+
+	for format, expected := range tests {
+		f, err := CompileFormat(format)
+		if err != nil {
+			t.Errorf("%q: %s", format, err)
+			continue
+		}
+
+		actual := strings.TrimSuffix(string(f.Format(nil, e)), "\n")
+		if actual != expected {
+			t.Errorf("%q was `%s`, but expected `%s`", format, actual, expected)
+		}
+	}
+}
+
+func TestCompileFormatWithoutRequest(t *testing.T) {
+	e := testEntry()
+
+	f := MustCompileFormat(`%a %{X-Request-Id}i %v`)
+
+	actual := string(f.Format(nil, e))
+	expected := "203.0.113.1 - -\n"
+	if actual != expected {
+		t.Errorf("Was `%s`, but expected `%s`", actual, expected)
+	}
+}
+
+func TestCompileFormatErrors(t *testing.T) {
+	formats := []string{
+		`%`,
+		`%{Foo`,
+		`%{Foo}`,
+		`%Z`,
+		`%i`,
+		`%e`,
+		`%{SSL_FOO}x`,
+		`%{fortnights}T`,
+		`%{%Q}t`,
+	}
+
+	for _, format := range formats {
+		if _, err := CompileFormat(format); err == nil {
+			t.Errorf("%q should not have compiled", format)
+		}
+	}
+}
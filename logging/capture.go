@@ -0,0 +1,210 @@
+package logging
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A CaptureConfig determines which requests are captured in full, and what's
+// redacted from them.
+type CaptureConfig struct {
+	// Paths are the paths of requests to capture. A path ending in a slash
+	// matches as a prefix, so "/" captures every request.
+	Paths []string
+
+	// Networks are the networks of clients whose requests are captured, as
+	// determined by the handler's clientip.Resolver.
+	Networks []*net.IPNet
+
+	// MaxBodySize is the number of bytes of each request and response body to
+	// capture. The default is 4KiB.
+	MaxBodySize int
+
+	// RedactHeaders are the names of headers whose values are redacted, in
+	// addition to Authorization, Proxy-Authorization, Cookie, and Set-Cookie.
+	RedactHeaders []string
+
+	// RedactFields are the names of JSON object fields whose string, number,
+	// and boolean values are redacted from bodies, wherever they appear.
+	RedactFields []string
+}
+
+// WithCapture returns an Option which writes the headers and the beginning of
+// the bodies of matching requests and their responses to the given Writer, as
+// JSON objects, one per line:
+//
+//	{"time":"2014-06-03T16:45:22.036Z","remote_addr":"203.0.113.1","method":"POST","uri":"/login","status":200,"request_id":"req12345","request_headers":{"Authorization":"[REDACTED]","Content-Type":"application/json"},"request_body":"{\"user\":\"coda\",\"password\":\"[REDACTED]\"}","response_headers":{},"response_body":"ok"}
+//
+// Bodies are captured as they're read and written, so streaming is unaffected,
+// but a capture only includes as much of the request body as the handler read.
+// Truncated bodies are marked by request_body_truncated and
+// response_body_truncated fields. Captured responses aren't written with
+// sendfile(2).
+func WithCapture(w io.Writer, config CaptureConfig) Option {
+	return func(al *LoggingHandler) {
+		c := &capture{
+			w:        w,
+			paths:    config.Paths,
+			networks: config.Networks,
+			max:      config.MaxBodySize,
+			redact: map[string]bool{
+				"Authorization":       true,
+				"Proxy-Authorization": true,
+				"Cookie":              true,
+				"Set-Cookie":          true,
+			},
+		}
+		if c.max <= 0 {
+			c.max = 4 * 1024
+		}
+
+		for _, name := range config.RedactHeaders {
+			c.redact[http.CanonicalHeaderKey(name)] = true
+		}
+
+		if len(config.RedactFields) > 0 {
+			names := make([]string, len(config.RedactFields))
+			for i, name := range config.RedactFields {
+				names[i] = regexp.QuoteMeta(name)
+			}
+
+			// Bodies may be truncated, so match values without closing quotes.
+			c.fields = regexp.MustCompile(`("(?:` + strings.Join(names, "|") + `)"\s*:\s*)(?:"(?:[^"\\]|\\.)*"?|[^\s,}\]]+)`)
+		}
+		al.capture = c
+	}
+}
+
+type capture struct {
+	w        io.Writer
+	paths    []string
+	networks []*net.IPNet
+	max      int
+	redact   map[string]bool
+	fields   *regexp.Regexp
+	queue    *queue
+}
+
+const redacted = "[REDACTED]"
+
+// matches returns whether or not a request for the given path from the given
+// client IP should be captured.
+func (c *capture) matches(path, ip string) bool {
+	for _, p := range c.paths {
+		if p == path || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+
+	if len(c.networks) > 0 {
+		if addr := net.ParseIP(ip); addr != nil {
+			for _, n := range c.networks {
+				if n.Contains(addr) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (c *capture) format(b []byte, e *Entry, req, resp *capped) []byte {
+	b = append(b, `{"time":"`...)
+	b = e.Start.In(time.UTC).AppendFormat(b, isoFormat)
+	b = append(b, '"')
+	b = appendJSONField(b, "remote_addr", e.RemoteAddr)
+	b = appendJSONField(b, "user", e.User)
+	b = appendJSONField(b, "method", e.Method)
+	b = appendJSONField(b, "uri", e.RequestURI)
+	b = appendJSONField(b, "proto", e.Proto)
+	b = append(b, `,"status":`...)
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = appendJSONField(b, "request_id", e.RequestID)
+	if e.Request != nil {
+		b = c.appendHeaders(b, "request_headers", e.Request.Header)
+	}
+	b = c.appendBody(b, "request_body", req)
+	b = c.appendHeaders(b, "response_headers", e.ResponseHeader)
+	b = c.appendBody(b, "response_body", resp)
+	b = appendJSONFields(b, e.Fields)
+	return append(b, "}\n"...)
+}
+
+func (c *capture) appendHeaders(b []byte, key string, h http.Header) []byte {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b = append(b, ',', '"')
+	b = append(b, key...)
+	b = append(b, `":{`...)
+	for i, name := range names {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, name)
+		b = append(b, ':')
+		if c.redact[http.CanonicalHeaderKey(name)] {
+			b = appendJSONString(b, redacted)
+		} else {
+			b = appendJSONString(b, strings.Join(h[name], ", "))
+		}
+	}
+	return append(b, '}')
+}
+
+func (c *capture) appendBody(b []byte, key string, body *capped) []byte {
+	if body == nil || len(body.b) == 0 {
+		return b
+	}
+
+	s := string(body.b)
+	if c.fields != nil {
+		s = c.fields.ReplaceAllString(s, `${1}"`+redacted+`"`)
+	}
+	b = appendJSONField(b, key, s)
+
+	if body.truncated {
+		b = append(b, `,"`...)
+		b = append(b, key...)
+		b = append(b, `_truncated":true`...)
+	}
+	return b
+}
+
+// capped is a Writer which keeps the first max bytes written to it.
+type capped struct {
+	b         []byte
+	max       int
+	truncated bool
+}
+
+func (c *capped) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := c.max - len(c.b); n > room {
+		c.truncated = true
+		p = p[:room]
+	}
+	c.b = append(c.b, p...)
+	return n, nil
+}
+
+// A capturedBody keeps the first bytes read from a request body.
+type capturedBody struct {
+	io.ReadCloser
+	captured capped
+}
+
+func (b *capturedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	_, _ = b.captured.Write(p[:n])
+	return n, err
+}
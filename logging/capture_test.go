@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCaptureMatches(t *testing.T) {
+	_, network, err := net.ParseCIDR("198.51.100.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &capture{
+		paths:    []string{"/login", "/api/"},
+		networks: []*net.IPNet{network},
+	}
+
+	tests := []struct {
+		path, ip string
+		matches  bool
+	}{
+		{"/login", "203.0.113.1", true},
+		{"/login/", "203.0.113.1", false},
+		{"/api/users", "203.0.113.1", true},
+		{"/", "198.51.100.7", true},
+		{"/", "203.0.113.1", false},
+		{"/", "not an ip", false},
+	}
+
+	for _, test := range tests {
+		if v := c.matches(test.path, test.ip); v != test.matches {
+			t.Errorf("Matching %s from %s was %v, but expected %v", test.path, test.ip, v, test.matches)
+		}
+	}
+}
+
+func TestCapture(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := ioutil.ReadAll(r.Body); err != nil {
+				t.Error(err)
+			}
+			w.Header().Set("Set-Cookie", "session=secret")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"token": "abcdef", "expires": 3600, "scopes": ["read", "write"]}`))
+		}),
+		ioutil.Discard,
+		WithCapture(out, CaptureConfig{
+			Paths:         []string{"/login"},
+			MaxBodySize:   48,
+			RedactHeaders: []string{"x-api-key"},
+			RedactFields:  []string{"password", "token", "expires"},
+		}),
+	)
+	logger.clock = mockClock()
+	logger.Start()
+
+	for _, path := range []string{"/login", "/"} {
+		r, err := http.NewRequest("POST", path, strings.NewReader(`{"user":"coda","password":"hunter\"2"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoteAddr = "203.0.113.1:5150"
+		r.RequestURI = path
+		r.Proto = "HTTP/1.1"
+		r.Header.Set("Authorization", "Bearer secret")
+		r.Header.Set("X-Api-Key", "secret")
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(xRequestID, "req12345")
+
+		logger.ServeHTTP(discardWriter{}, r)
+	}
+	logger.Flush()
+
+	actual := out.String()
+	expected := `{"time":"2014-06-03T16:45:22.036Z","remote_addr":"203.0.113.1","method":"POST","uri":"/login","proto":"HTTP/1.1","status":200,"request_id":"req12345",` +
+		`"request_headers":{"Authorization":"[REDACTED]","Content-Type":"application/json","X-Api-Key":"[REDACTED]","X-Request-Id":"req12345"},` +
+		`"request_body":"{\"user\":\"coda\",\"password\":\"[REDACTED]\"}",` +
+		`"response_headers":{"Content-Type":"application/json","Set-Cookie":"[REDACTED]"},` +
+		`"response_body":"{\"token\": \"[REDACTED]\", \"expires\": \"[REDACTED]\", \"scopes\": [",` +
+		`"response_body_truncated":true}` + "\n"
+	if actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// A ConnInfo describes the connection a request was made over.
+type ConnInfo struct {
+	TLSVersion  string // e.g. "TLS 1.3", or empty if the connection isn't TLS
+	CipherSuite string // e.g. "TLS_AES_128_GCM_SHA256"
+	ServerName  string // the server name the client asked for with SNI
+	ALPN        string // the protocol negotiated with ALPN, e.g. "h2"
+	ClientCert  string // the subject of the client's certificate, if any
+
+	// Requests is the number of requests served over the connection so far,
+	// including this one, or zero if the server doesn't use ConnContext. A
+	// connection has been reused if it's more than one.
+	Requests int64
+}
+
+// WithConnInfo returns an Option which records the details of the connection
+// each request was made over in its log entry. Only the JSON and Logfmt
+// formatters, and Apache formats with %k or %{SSL_...}x directives, include
+// them; Combined and Common lines are unchanged.
+//
+// To record the number of requests served over each connection, the server
+// must also use ConnContext:
+//
+//	srv := &http.Server{
+//		Handler:     logger,
+//		ConnContext: logging.ConnContext,
+//	}
+//
+// If the server already has a ConnContext hook, call both:
+//
+//	srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+//		return logging.ConnContext(connContext(ctx, c), c)
+//	}
+func WithConnInfo() Option {
+	return func(al *LoggingHandler) {
+		al.connInfo = true
+	}
+}
+
+type connCounter struct {
+	requests int64
+}
+
+const connKey contextKey = 1
+
+// ConnContext is an http.Server ConnContext hook which allows LoggingHandlers
+// configured with WithConnInfo to count the requests served over each
+// connection. It returns a child of the given context, so it can be chained
+// with other hooks.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey, &connCounter{})
+}
+
+// newConnInfo returns the details of the connection the given request was made
+// over, counting the request.
+func newConnInfo(r *http.Request) ConnInfo {
+	var info ConnInfo
+	if counter, ok := r.Context().Value(connKey).(*connCounter); ok {
+		// HTTP/2 connections serve requests concurrently.
+		info.Requests = atomic.AddInt64(&counter.requests, 1)
+	}
+
+	if r.TLS != nil {
+		info.TLSVersion = tls.VersionName(r.TLS.Version)
+		info.CipherSuite = tls.CipherSuiteName(r.TLS.CipherSuite)
+		info.ServerName = r.TLS.ServerName
+		info.ALPN = r.TLS.NegotiatedProtocol
+		if len(r.TLS.PeerCertificates) > 0 {
+			info.ClientCert = r.TLS.PeerCertificates[0].Subject.String()
+		}
+	}
+	return info
+}
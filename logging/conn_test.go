@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConnInfo(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		buf,
+		WithFormatter(JSON),
+		WithConnInfo(),
+	)
+	logger.Start()
+
+	server := httptest.NewUnstartedServer(logger)
+	server.Config.ConnContext = ConnContext
+	server.StartTLS()
+	defer server.Close()
+
+	client := server.Client()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	logger.Flush()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Logged %d lines, but expected 2", len(lines))
+	}
+
+	for i, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if v := entry["conn_requests"]; v != float64(i+1) {
+			t.Errorf("conn_requests was %v, but expected %d", v, i+1)
+		}
+
+		if v, _ := entry["tls_version"].(string); !strings.HasPrefix(v, "TLS 1.") {
+			t.Errorf("tls_version was %v", entry["tls_version"])
+		}
+
+		if v, _ := entry["tls_cipher"].(string); !strings.HasPrefix(v, "TLS_") {
+			t.Errorf("tls_cipher was %v", entry["tls_cipher"])
+		}
+	}
+}
+
+func TestConnInfoPlaintext(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if info := newConnInfo(r); info != (ConnInfo{}) {
+		t.Errorf("Info was %+v, but expected nothing", info)
+	}
+}
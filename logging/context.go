@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"sync"
+)
+
+// requestInfo is what handlers further down the stack have to say about a
+// request, for inclusion in its log entry.
+type requestInfo struct {
+	m      sync.Mutex
+	user   string
+	fields []Field
+}
+
+type contextKey int
+
+const infoKey contextKey = 0
+
+func withRequestInfo(ctx context.Context) (context.Context, *requestInfo) {
+	info := &requestInfo{}
+	return context.WithValue(ctx, infoKey, info), info
+}
+
+// SetUser records the authenticated user who made the request with the given
+// context, e.g. the common name of a client certificate or a Basic auth
+// username, so that it appears in the request's log entry. It has no effect if
+// the request isn't being logged by a LoggingHandler.
+func SetUser(ctx context.Context, user string) {
+	if info, ok := ctx.Value(infoKey).(*requestInfo); ok {
+		info.m.Lock()
+		info.user = user
+		info.m.Unlock()
+	}
+}
+
+func (info *requestInfo) User() string {
+	info.m.Lock()
+	defer info.m.Unlock()
+	return info.user
+}
+
+// A Field is a key and value added to a request's log entry by a handler.
+type Field struct {
+	Key, Value string
+}
+
+// AddField adds a field, such as a tenant ID or whether or not a cache was hit,
+// to the log entry of the request with the given context. Adding a field with
+// the same key as an earlier one replaces its value. It may be called from any
+// goroutine, but fields added after the handler returns may not be logged. It
+// has no effect if the request isn't being logged by a LoggingHandler.
+//
+// Keys should be short and free of spaces, quotes, and equals signs, so they
+// can be used unquoted in every format.
+func AddField(ctx context.Context, key, value string) {
+	if info, ok := ctx.Value(infoKey).(*requestInfo); ok {
+		info.m.Lock()
+		defer info.m.Unlock()
+
+		for i, f := range info.fields {
+			if f.Key == key {
+				info.fields[i].Value = value
+				return
+			}
+		}
+		info.fields = append(info.fields, Field{Key: key, Value: value})
+	}
+}
+
+// Fields returns a copy of the fields added so far, or nil if there are none.
+func (info *requestInfo) Fields() []Field {
+	info.m.Lock()
+	defer info.m.Unlock()
+
+	if len(info.fields) == 0 {
+		return nil
+	}
+	return append([]Field(nil), info.fields...)
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestAddField(t *testing.T) {
+	ctx, info := withRequestInfo(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			AddField(ctx, fmt.Sprintf("f%d", i%2), "v")
+		}(i)
+	}
+	wg.Wait()
+
+	AddField(ctx, "f0", "replaced")
+
+	fields := info.Fields()
+	if len(fields) != 2 {
+		t.Fatalf("Fields were %v, but expected two", fields)
+	}
+
+	for _, f := range fields {
+		if f.Key == "f0" && f.Value != "replaced" {
+			t.Errorf("f0 was %q, but expected it to be replaced", f.Value)
+		}
+	}
+
+	// Without a LoggingHandler, fields go nowhere.
+	AddField(context.Background(), "f0", "v")
+}
+
+func TestLoggingHandlerFields(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AddField(r.Context(), "tenant", "acme")
+			AddField(r.Context(), "cache", "hit")
+		}),
+		buf,
+		WithFormatter(FormatterFunc(func(b []byte, e *Entry) []byte {
+			expected := []Field{{Key: "tenant", Value: "acme"}, {Key: "cache", Value: "hit"}}
+			if !reflect.DeepEqual(e.Fields, expected) {
+				t.Errorf("Fields were %v, but expected %v", e.Fields, expected)
+			}
+			return append(b, "ok\n"...)
+		})),
+	)
+	logger.Start()
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.ServeHTTP(discardWriter{}, r)
+	logger.Flush()
+
+	if buf.String() != "ok\n" {
+		t.Errorf("Output was %q", buf.String())
+	}
+}
@@ -0,0 +1,315 @@
+package logging
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A Formatter renders log entries as lines of text.
+type Formatter interface {
+	// Format appends a line describing the given entry, including the trailing
+	// newline, to b and returns the extended buffer.
+	Format(b []byte, e *Entry) []byte
+}
+
+// The FormatterFunc type is an adapter to allow the use of ordinary functions
+// as formatters.
+type FormatterFunc func(b []byte, e *Entry) []byte
+
+// Format calls f(b, e).
+func (f FormatterFunc) Format(b []byte, e *Entry) []byte {
+	return f(b, e)
+}
+
+var (
+	// Combined formats entries as NCSA/Apache combined log lines, followed by
+	// the request duration in milliseconds, the quoted request ID, the sample
+	// rate if the request was sampled, and any fields added by the handler:
+	//
+	//     203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13 "-" "curl" 1007 "req12345" 0.01 tenant="acme"
+	Combined Formatter = FormatterFunc(formatCombined)
+
+	// Common formats entries as NCSA/Apache common log lines, followed by any
+	// fields added by the handler:
+	//
+	//     203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13
+	Common Formatter = FormatterFunc(formatCommon)
+
+	// JSON formats entries as single-line JSON objects, with any fields added
+	// by the handler in a nested object. Empty string fields are omitted:
+	//
+	//     {"time":"2014-06-03T16:45:22.036Z","remote_addr":"203.0.113.1",...,"fields":{"tenant":"acme"}}
+	JSON Formatter = FormatterFunc(formatJSON)
+
+	// Logfmt formats entries as logfmt key=value pairs, followed by any fields
+	// added by the handler. Empty string fields are omitted:
+	//
+	//     time=2014-06-03T16:45:22.036Z remote_addr=203.0.113.1 method=GET ... tenant=acme
+	Logfmt Formatter = FormatterFunc(formatLogfmt)
+)
+
+const (
+	apacheFormat = "02/Jan/2006:15:04:05 -0700"
+	isoFormat    = "2006-01-02T15:04:05.000Z07:00"
+)
+
+func formatCommon(b []byte, e *Entry) []byte {
+	b = appendCommon(b, e)
+	b = appendQuotedFields(b, e.Fields)
+	return append(b, '\n')
+}
+
+func formatCombined(b []byte, e *Entry) []byte {
+	b = appendCommon(b, e)
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, orDash(e.Referer))
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, orDash(e.UserAgent))
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(e.Duration/time.Millisecond), 10)
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, e.RequestID)
+	if e.SampleRate > 0 {
+		b = append(b, ' ')
+		b = strconv.AppendFloat(b, e.SampleRate, 'g', -1, 64)
+	}
+	b = appendQuotedFields(b, e.Fields)
+	return append(b, '\n')
+}
+
+// appendQuotedFields appends fields as key="value" pairs.
+func appendQuotedFields(b []byte, fields []Field) []byte {
+	for _, f := range fields {
+		b = append(b, ' ')
+		b = append(b, f.Key...)
+		b = append(b, '=')
+		b = strconv.AppendQuote(b, f.Value)
+	}
+	return b
+}
+
+func appendCommon(b []byte, e *Entry) []byte {
+	b = append(b, e.RemoteAddr...)
+	b = append(b, " - "...) // We're not supporting identd, sorry.
+	b = appendUser(b, e.User)
+	b = append(b, " ["...)
+	b = e.Start.In(time.UTC).AppendFormat(b, apacheFormat)
+	b = append(b, "] \""...)
+	b = append(b, e.Method...)
+	b = append(b, ' ')
+	b = append(b, e.RequestURI...)
+	b = append(b, ' ')
+	b = append(b, e.Proto...)
+	b = append(b, "\" "...)
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, e.Size, 10)
+	return b
+}
+
+// appendUser appends the user, quoted if it has spaces or anything else which
+// would break up the line, such as a client certificate's CN or a Basic auth
+// username might.
+func appendUser(b []byte, user string) []byte {
+	if user == "" {
+		return append(b, '-')
+	}
+	if strings.IndexFunc(user, needsQuoting) == -1 {
+		return append(b, user...)
+	}
+	return strconv.AppendQuote(b, user)
+}
+
+func formatJSON(b []byte, e *Entry) []byte {
+	b = append(b, `{"time":"`...)
+	b = e.Start.In(time.UTC).AppendFormat(b, isoFormat)
+	b = append(b, '"')
+	b = appendJSONField(b, "remote_addr", e.RemoteAddr)
+	b = appendJSONField(b, "user", e.User)
+	b = appendJSONField(b, "method", e.Method)
+	b = appendJSONField(b, "uri", e.RequestURI)
+	b = appendJSONField(b, "proto", e.Proto)
+	b = append(b, `,"status":`...)
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, `,"size":`...)
+	b = strconv.AppendInt(b, e.Size, 10)
+	b = append(b, `,"duration_ms":`...)
+	b = appendMillis(b, e.Duration)
+	if e.TimeToFirstByte > 0 {
+		b = append(b, `,"ttfb_ms":`...)
+		b = appendMillis(b, e.TimeToFirstByte)
+	}
+	b = appendJSONField(b, "referer", e.Referer)
+	b = appendJSONField(b, "user_agent", e.UserAgent)
+	b = appendJSONField(b, "request_id", e.RequestID)
+	b = appendJSONField(b, "tls_version", e.Conn.TLSVersion)
+	b = appendJSONField(b, "tls_cipher", e.Conn.CipherSuite)
+	b = appendJSONField(b, "tls_server_name", e.Conn.ServerName)
+	b = appendJSONField(b, "alpn", e.Conn.ALPN)
+	b = appendJSONField(b, "client_cert", e.Conn.ClientCert)
+	if e.Conn.Requests > 0 {
+		b = append(b, `,"conn_requests":`...)
+		b = strconv.AppendInt(b, e.Conn.Requests, 10)
+	}
+	if e.SampleRate > 0 {
+		b = append(b, `,"sample_rate":`...)
+		b = strconv.AppendFloat(b, e.SampleRate, 'g', -1, 64)
+	}
+	b = appendJSONFields(b, e.Fields)
+	return append(b, "}\n"...)
+}
+
+// appendJSONFields appends fields as a nested object, if there are any.
+func appendJSONFields(b []byte, fields []Field) []byte {
+	if len(fields) == 0 {
+		return b
+	}
+
+	b = append(b, `,"fields":{`...)
+	for i, f := range fields {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, f.Key)
+		b = append(b, ':')
+		b = appendJSONString(b, f.Value)
+	}
+	return append(b, '}')
+}
+
+func formatLogfmt(b []byte, e *Entry) []byte {
+	b = append(b, "time="...)
+	b = e.Start.In(time.UTC).AppendFormat(b, isoFormat)
+	b = appendLogfmtField(b, "remote_addr", e.RemoteAddr)
+	b = appendLogfmtField(b, "user", e.User)
+	b = appendLogfmtField(b, "method", e.Method)
+	b = appendLogfmtField(b, "uri", e.RequestURI)
+	b = appendLogfmtField(b, "proto", e.Proto)
+	b = append(b, " status="...)
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, " size="...)
+	b = strconv.AppendInt(b, e.Size, 10)
+	b = append(b, " duration_ms="...)
+	b = appendMillis(b, e.Duration)
+	if e.TimeToFirstByte > 0 {
+		b = append(b, " ttfb_ms="...)
+		b = appendMillis(b, e.TimeToFirstByte)
+	}
+	b = appendLogfmtField(b, "referer", e.Referer)
+	b = appendLogfmtField(b, "user_agent", e.UserAgent)
+	b = appendLogfmtField(b, "request_id", e.RequestID)
+	b = appendLogfmtField(b, "tls_version", e.Conn.TLSVersion)
+	b = appendLogfmtField(b, "tls_cipher", e.Conn.CipherSuite)
+	b = appendLogfmtField(b, "tls_server_name", e.Conn.ServerName)
+	b = appendLogfmtField(b, "alpn", e.Conn.ALPN)
+	b = appendLogfmtField(b, "client_cert", e.Conn.ClientCert)
+	if e.Conn.Requests > 0 {
+		b = append(b, " conn_requests="...)
+		b = strconv.AppendInt(b, e.Conn.Requests, 10)
+	}
+	if e.SampleRate > 0 {
+		b = append(b, " sample_rate="...)
+		b = strconv.AppendFloat(b, e.SampleRate, 'g', -1, 64)
+	}
+	b = appendLogfmtFields(b, e.Fields)
+	return append(b, '\n')
+}
+
+func appendLogfmtFields(b []byte, fields []Field) []byte {
+	for _, f := range fields {
+		b = append(b, ' ')
+		b = append(b, f.Key...)
+		b = append(b, '=')
+		b = appendLogfmtValue(b, f.Value)
+	}
+	return b
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// appendMillis appends the duration in milliseconds, with microsecond
+// precision.
+func appendMillis(b []byte, d time.Duration) []byte {
+	return strconv.AppendFloat(b, float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+func appendJSONField(b []byte, key, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = append(b, ',', '"')
+	b = append(b, key...)
+	b = append(b, '"', ':')
+	return appendJSONString(b, value)
+}
+
+const hex = "0123456789abcdef"
+
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `�`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+func appendLogfmtField(b []byte, key, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = append(b, ' ')
+	b = append(b, key...)
+	b = append(b, '=')
+	return appendLogfmtValue(b, value)
+}
+
+func appendLogfmtValue(b []byte, s string) []byte {
+	if strings.IndexFunc(s, needsQuoting) == -1 {
+		return append(b, s...)
+	}
+	return strconv.AppendQuote(b, s)
+}
+
+func needsQuoting(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError
+}
@@ -0,0 +1,174 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry() *Entry {
+	return &Entry{
+		Start:           time.Date(2014, 6, 3, 16, 45, 22, 36e6, time.UTC),
+		Duration:        1007 * time.Millisecond,
+		TimeToFirstByte: 5500 * time.Microsecond,
+		RemoteAddr:      "203.0.113.1",
+		Method:          "GET",
+		RequestURI:      "/search?q=a b",
+		Proto:           "HTTP/1.1",
+		Status:          200,
+		Size:            13,
+		UserAgent:       "gotest \"quoted\"",
+		RequestID:       "req12345",
+	}
+}
+
+func TestCombined(t *testing.T) {
+	actual := string(Combined.Format(nil, testEntry()))
+	expected := `203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET /search?q=a b HTTP/1.1" 200 13 "-" "gotest \"quoted\"" 1007 "req12345"` + "\n"
+	if actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+}
+
+func TestCommon(t *testing.T) {
+	actual := string(Common.Format(nil, testEntry()))
+	expected := `203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET /search?q=a b HTTP/1.1" 200 13` + "\n"
+	if actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+}
+
+func TestCommonUser(t *testing.T) {
+	e := testEntry()
+	e.User = "CN=John Smith"
+
+	actual := string(Common.Format(nil, e))
+	expected := `203.0.113.1 - "CN=John Smith" [03/Jun/2014:16:45:22 +0000] "GET /search?q=a b HTTP/1.1" 200 13` + "\n"
+	if actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+
+	e.User = "john smith\n5.6.7.8 - admin"
+	if actual := string(Combined.Format(nil, e)); strings.Count(actual, "\n") != 1 {
+		t.Errorf("User broke the line: %q", actual)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	e := testEntry()
+	e.Referer = "http://example.com/\x00☃\xff"
+
+	b := JSON.Format(nil, e)
+
+	var actual map[string]interface{}
+	if err := json.Unmarshal(b, &actual); err != nil {
+		t.Fatalf("Invalid JSON %q: %s", b, err)
+	}
+
+	expected := map[string]interface{}{
+		"time":        "2014-06-03T16:45:22.036Z",
+		"remote_addr": "203.0.113.1",
+		"method":      "GET",
+		"uri":         "/search?q=a b",
+		"proto":       "HTTP/1.1",
+		"status":      float64(200),
+		"size":        float64(13),
+		"duration_ms": float64(1007),
+		"ttfb_ms":     5.5,
+		"referer":     "http://example.com/\x00☃�",
+		"user_agent":  "gotest \"quoted\"",
+		"request_id":  "req12345",
+	}
+
+	if len(actual) != len(expected) {
+		t.Errorf("Was %v, but expected %v", actual, expected)
+	}
+
+	for k, v := range expected {
+		if actual[k] != v {
+			t.Errorf("%s was %#v, but expected %#v", k, actual[k], v)
+		}
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	actual := string(Logfmt.Format(nil, testEntry()))
+	expected := `time=2014-06-03T16:45:22.036Z remote_addr=203.0.113.1 method=GET uri="/search?q=a b" proto=HTTP/1.1 status=200 size=13 duration_ms=1007.000 ttfb_ms=5.500 user_agent="gotest \"quoted\"" request_id=req12345` + "\n"
+	if actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+}
+
+func BenchmarkCombined(b *testing.B) {
+	e := testEntry()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		line := getRecord()
+		line.b = Combined.Format(line.b, e)
+		releaseRecord(line)
+	}
+}
+
+// BenchmarkCombinedSprintf is how combined lines used to be formatted, for
+// comparison.
+func BenchmarkCombinedSprintf(b *testing.B) {
+	e := testEntry()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = fmt.Sprintf(
+			"%s %s %s [%s] \"%s %s %s\" %d %d %q %q %d %q\n",
+			e.RemoteAddr,
+			"-",
+			"-",
+			e.Start.In(time.UTC).Format(apacheFormat),
+			e.Method,
+			e.RequestURI,
+			e.Proto,
+			e.Status,
+			e.Size,
+			orDash(e.Referer),
+			orDash(e.UserAgent),
+			e.Duration.Nanoseconds()/int64(time.Millisecond),
+			e.RequestID,
+		)
+	}
+}
+
+func TestCombinedSampled(t *testing.T) {
+	e := testEntry()
+	e.SampleRate = 0.01
+
+	actual := string(Combined.Format(nil, e))
+	expected := `203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET /search?q=a b HTTP/1.1" 200 13 "-" "gotest \"quoted\"" 1007 "req12345" 0.01` + "\n"
+	if actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+}
+
+func TestFields(t *testing.T) {
+	e := testEntry()
+	e.Fields = []Field{{Key: "tenant", Value: "acme corp"}, {Key: "cache", Value: "hit"}}
+
+	tests := []struct {
+		f        Formatter
+		expected string
+	}{
+		{Common, ` 200 13 tenant="acme corp" cache="hit"` + "\n"},
+		{Combined, ` "req12345" tenant="acme corp" cache="hit"` + "\n"},
+		{JSON, `,"request_id":"req12345","fields":{"tenant":"acme corp","cache":"hit"}}` + "\n"},
+		{Logfmt, ` request_id=req12345 tenant="acme corp" cache=hit` + "\n"},
+	}
+
+	for _, test := range tests {
+		actual := string(test.f.Format(nil, e))
+		if !strings.HasSuffix(actual, test.expected) {
+			t.Errorf("Was \n`%s`\n, but expected it to end with \n`%s`", actual, test.expected)
+		}
+	}
+}
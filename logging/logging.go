@@ -1,132 +1,352 @@
 // Package logging provides a fast, asynchronous request logger which outputs
-// NCSA/Apache combined logs.
+// NCSA/Apache combined logs, or any other format via a Formatter.
 package logging
 
 import (
-	"bufio"
-	"errors"
-	"fmt"
+	"context"
 	"io"
-	"net"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
+
+	"github.com/codahale/http-handlers/clientip"
 )
 
 // A LoggingHandler is a HTTP handler which proxies requests to an underlying
 // handler and logs the results.
 type LoggingHandler struct {
-	clock   clock
-	w       io.Writer
-	handler http.Handler
-	buffer  chan string
-	quit    chan struct{}
+	clock          clock
+	w              io.Writer
+	handler        http.Handler
+	formatter      Formatter
+	clientIP       *clientip.Resolver
+	size           int
+	overflow       OverflowPolicy
+	batchSize      int
+	interval       time.Duration
+	sampling       []SampleRule
+	slow           *slowLog
+	capture        *capture
+	tail           *Tail
+	top            *Top
+	connInfo       bool
+	excludedPaths  []string
+	excludedAgents []string
+	rewrites       []func(string) string
+	sinkConfigs    []Sink
+	sinks          []*sink
+}
+
+// An Option configures a LoggingHandler.
+type Option func(*LoggingHandler)
+
+// WithFormatter returns an Option which formats the log entries written to the
+// handler's Writer with the given Formatter instead of Combined.
+func WithFormatter(f Formatter) Option {
+	return func(al *LoggingHandler) {
+		al.formatter = f
+	}
+}
+
+// WithClientIP returns an Option which logs the client IP address determined by
+// the given Resolver. By default, no proxies are trusted and the address the
+// request came from is logged.
+func WithClientIP(r *clientip.Resolver) Option {
+	return func(al *LoggingHandler) {
+		al.clientIP = r
+	}
+}
+
+// WithBufferSize returns an Option which buffers up to the given number of log
+// lines, rather than the default of 1000. The buffer holds at least one line.
+func WithBufferSize(n int) Option {
+	return func(al *LoggingHandler) {
+		if n < 1 {
+			n = 1
+		}
+		al.size = n
+	}
+}
+
+// WithOverflowPolicy returns an Option which determines what happens to log
+// lines when the buffer is full. The default is Block.
+//
+// Dropped lines are counted, and the number of buffered lines across all
+// handlers tracked, as the following metrics:
+//
+//	HTTP.Log.Dropped
+//	HTTP.Log.QueueDepth
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return func(al *LoggingHandler) {
+		al.overflow = p
+	}
+}
+
+// WithBatching returns an Option which batches log lines into writes of up to
+// maxBytes, waiting up to the given interval for a batch to fill. By default,
+// batches are up to 64KiB and are written as soon as there are no more lines
+// waiting.
+func WithBatching(maxBytes int, interval time.Duration) Option {
+	return func(al *LoggingHandler) {
+		al.batchSize = maxBytes
+		al.interval = interval
+	}
 }
 
 // Wrap returns the underlying handler, wrapped in a LoggingHandler which will
-// write to the given Writer. N.B.: You must call Start() on the result before
-// using it.
-func Wrap(h http.Handler, w io.Writer) *LoggingHandler {
-	return &LoggingHandler{
-		clock:   time.Now,
-		w:       w,
-		handler: h,
-		buffer:  make(chan string, 1000),
-		quit:    make(chan struct{}),
+// write to the given Writer, and to any sinks. The Writer may be nil if there
+// are sinks. N.B.: You must call Start() on the result before using it.
+func Wrap(h http.Handler, w io.Writer, opts ...Option) *LoggingHandler {
+	al := &LoggingHandler{
+		clock:     time.Now,
+		w:         w,
+		handler:   h,
+		formatter: Combined,
+		clientIP:  &clientip.Resolver{},
+		size:      1000,
+		overflow:  Block,
+		batchSize: 64 * 1024,
+	}
+	for _, opt := range opts {
+		opt(al)
+	}
+	al.sinks = al.newSinks()
+	if al.slow != nil {
+		al.slow.queue = newQueue(al.slow.w, al.size, al.overflow, al.batchSize, al.interval)
+	}
+	if al.capture != nil {
+		al.capture.queue = newQueue(al.capture.w, al.size, al.overflow, al.batchSize, al.interval)
+	}
+	return al
+}
+
+// queues returns the queues of the access log and any other logs.
+func (al *LoggingHandler) queues() []*queue {
+	var queues []*queue
+	for _, s := range al.sinks {
+		queues = append(queues, s.queue)
+	}
+	if al.slow != nil {
+		queues = append(queues, al.slow.queue)
 	}
+	if al.capture != nil {
+		queues = append(queues, al.capture.queue)
+	}
+	return queues
 }
 
-// Start creates a goroutine to handle the logging IO.
+// Start creates goroutines to handle the logging IO.
 func (al *LoggingHandler) Start() {
-	go func() {
-		for s := range al.buffer {
-			fmt.Fprint(al.w, s)
-		}
-		close(al.quit)
-	}()
+	for _, q := range al.queues() {
+		q.start()
+	}
+}
+
+// Flush blocks until all the log lines buffered so far have been written.
+func (al *LoggingHandler) Flush() {
+	for _, q := range al.queues() {
+		q.flush()
+	}
 }
 
-// Stop closes the internal channel used to buffer log statements and waits for
-// the IO goroutine to complete.
-func (al *LoggingHandler) Stop() {
-	close(al.buffer)
-	<-al.quit
+// Stop stops buffering log lines and waits for the IO goroutine to write those
+// already buffered, or for the context to be done. It returns the number of
+// lines which were buffered but not written, and the context's error if it
+// gave up waiting.
+//
+// It is safe to call Stop while requests are still being served. Their lines,
+// and those of any requests served after Stop, are dropped.
+func (al *LoggingHandler) Stop(ctx context.Context) (int, error) {
+	queues := al.queues()
+	for _, q := range queues {
+		q.close()
+	}
+
+	var (
+		lost int
+		err  error
+	)
+	for _, q := range queues {
+		n, qerr := q.wait(ctx)
+		lost += n
+		if err == nil {
+			err = qerr
+		}
+	}
+	return lost, err
 }
 
 func (al *LoggingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	wrapper := &responseWrapper{w: w, status: 200}
+	if al.excluded(r) {
+		al.handler.ServeHTTP(w, r)
+		return
+	}
+
+	ctx, info := withRequestInfo(r.Context())
+	r = r.WithContext(ctx)
+
+	wrapper := newResponseWrapper(w, al.clock)
+	var body *timedBody
+	if al.slow != nil {
+		wrapper.timeWrites = true
+		if r.Body != nil {
+			body = &timedBody{ReadCloser: r.Body, clock: al.clock}
+			r.Body = body
+		}
+	}
+
+	var conn ConnInfo
+	if al.connInfo {
+		conn = newConnInfo(r)
+	}
+
+	remoteAddr := al.clientIP.ClientIP(r)
+	var reqBody *capturedBody
+	if al.capture != nil && al.capture.matches(requestPath(r), remoteAddr) {
+		wrapper.capture = &capped{max: al.capture.max}
+		if r.Body != nil {
+			reqBody = &capturedBody{ReadCloser: r.Body, captured: capped{max: al.capture.max}}
+			r.Body = reqBody
+		}
+	}
 
 	start := al.clock()
 	al.handler.ServeHTTP(wrapper, r)
 	end := al.clock()
 
-	remoteAddr := r.RemoteAddr
-	if index := strings.LastIndex(remoteAddr, ":"); index != -1 {
-		remoteAddr = remoteAddr[:index]
+	status := wrapper.Status()
+	id := r.Header.Get(xRequestID)
+	rate := al.sampleRate(r, status)
+	logged := sample(id, rate)
+	slow := al.slow != nil && end.Sub(start) > al.slow.threshold
+	if !logged && !slow && wrapper.capture == nil {
+		return
 	}
 
-	if s := r.Header.Get(xForwardedFor); s != "" {
-		remoteAddr = s
+	e := entries.Get().(*Entry)
+	*e = Entry{
+		Start:      start,
+		Duration:   end.Sub(start),
+		RemoteAddr: remoteAddr,
+		User:       info.User(),
+		Method:     r.Method,
+		RequestURI: al.rewrite(r.RequestURI),
+		Proto:      r.Proto,
+		Status:     status,
+		Size:       wrapper.Size(),
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		RequestID:  id,
+		Fields:     info.Fields(),
+		Conn:       conn,
+
+		Request:        r,
+		ResponseHeader: wrapper.Header(),
+	}
+	if !wrapper.firstByte.IsZero() {
+		e.TimeToFirstByte = wrapper.firstByte.Sub(start)
+	}
+	if rate < 1 {
+		e.SampleRate = rate
 	}
 
-	referer := r.Referer()
-	if "" == referer {
-		referer = "-"
+	if slow {
+		t := timings{write: wrapper.writeTime}
+		if body != nil {
+			t.read = body.elapsed
+		}
+
+		record := getRecord()
+		record.b = al.slow.format(record.b, e, t)
+		record.status = e.Status
+		al.slow.queue.enqueue(record)
 	}
 
-	userAgent := r.UserAgent()
-	if "" == userAgent {
-		userAgent = "-"
+	if wrapper.capture != nil {
+		var req *capped
+		if reqBody != nil {
+			req = &reqBody.captured
+		}
+
+		record := getRecord()
+		record.b = al.capture.format(record.b, e, req, wrapper.capture)
+		record.status = e.Status
+		al.capture.queue.enqueue(record)
 	}
 
-	al.buffer <- fmt.Sprintf(
-		"%s %s %s [%s] \"%s %s %s\" %d %d %q %q %d %q\n",
-		remoteAddr,
-		"-", // We're not supporting identd, sorry.
-		"-", // We're also not supporting basic auth.
-		start.In(time.UTC).Format(apacheFormat),
-		r.Method,
-		r.RequestURI,
-		r.Proto,
-		wrapper.status,
-		0,
-		referer,
-		userAgent,
-		end.Sub(start).Nanoseconds()/int64(time.Millisecond),
-		r.Header.Get(xRequestID),
-	)
-}
+	if logged {
+		if al.tail != nil {
+			al.tail.add(e)
+		}
+		if al.top != nil {
+			al.top.add(e)
+		}
 
-const (
-	apacheFormat  = "02/Jan/2006:15:04:05 -0700"
-	xRequestID    = "X-Request-Id"
-	xForwardedFor = "X-Forwarded-For"
-)
+		for _, s := range al.sinks {
+			if s.filter != nil && !s.filter(e) {
+				continue
+			}
 
-type responseWrapper struct {
-	w      http.ResponseWriter
-	status int
-}
+			line := getRecord()
+			line.b = s.formatter.Format(line.b, e)
+			line.status = e.Status
+			s.queue.enqueue(line)
+		}
+	}
 
-func (w *responseWrapper) Header() http.Header {
-	return w.w.Header()
+	*e = Entry{} // don't keep the request alive
+	entries.Put(e)
 }
 
-func (w *responseWrapper) Write(b []byte) (int, error) {
-	return w.w.Write(b)
+var entries = sync.Pool{
+	New: func() interface{} {
+		return new(Entry)
+	},
 }
 
-func (w *responseWrapper) WriteHeader(status int) {
-	w.status = status
-	w.w.WriteHeader(status)
+// An Entry is the information logged about a single request.
+type Entry struct {
+	Start           time.Time     // when the request was received
+	Duration        time.Duration // how long the handler took to respond
+	TimeToFirstByte time.Duration // zero if no response body was written
+	RemoteAddr      string        // the client's address, without a port
+	User            string        // the authenticated user, if any
+	Method          string
+	RequestURI      string
+	Proto           string
+	Status          int
+	Size            int64 // the number of bytes in the response body
+	Referer         string
+	UserAgent       string
+	RequestID       string // the value of the X-Request-Id header, if any
+
+	// Conn describes the connection the request was made over, if the
+	// LoggingHandler was configured WithConnInfo.
+	Conn ConnInfo
+
+	// Fields are the fields added by the handler with AddField, in the order
+	// they were first added.
+	Fields []Field
+
+	// SampleRate is the fraction of requests like this one which are logged,
+	// or zero if all of them are.
+	SampleRate float64
+
+	// Request and ResponseHeader are the request itself and the headers of
+	// the response, for formatters which need more than the fields above.
+	// They are only valid during a call to Format.
+	Request        *http.Request
+	ResponseHeader http.Header
 }
 
-func (w *responseWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	if hijacker, ok := w.w.(http.Hijacker); ok {
-		return hijacker.Hijack()
-	} else {
-		return nil, nil, errors.New("http-handler: wrapped responsewrapper does not implement http.Hijack")
+const xRequestID = "X-Request-Id"
+
+// requestPath returns the path of the request, if it has a URL.
+func requestPath(r *http.Request) string {
+	if r.URL == nil {
+		return ""
 	}
+	return r.URL.Path
 }
 
 type clock func() time.Time
@@ -2,12 +2,17 @@ package logging
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/codahale/http-handlers/clientip"
+	"github.com/codahale/metrics"
 )
 
 func mockClock() clock {
@@ -17,7 +22,9 @@ func mockClock() clock {
 	}
 	return func() time.Time {
 		t := times[0]
-		times = times[1:]
+		if len(times) > 1 {
+			times = times[1:]
+		}
 		return t
 	}
 }
@@ -26,11 +33,13 @@ func TestLoggingHandler(t *testing.T) {
 	out := bytes.NewBuffer(nil)
 	logger := Wrap(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			SetUser(r.Context(), "coda")
 			w.Header().Set("Content-Type", "text/greeting")
 			w.WriteHeader(200)
 			fmt.Fprint(w, "Hello, world!")
 		}),
 		out,
+		WithClientIP(clientip.MustResolver(clientip.XForwardedFor, "127.0.0.1")),
 	)
 	logger.clock = mockClock()
 	logger.Start()
@@ -62,11 +71,169 @@ func TestLoggingHandler(t *testing.T) {
 		t.Errorf("Response was %#v, but expected %#v", actual, expected)
 	}
 
-	logger.Stop()
+	logger.Stop(context.Background())
 
 	actual = out.String()
-	expected = `203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 0 "-" "gotest" 1007 "req12345"` + "\n"
+	expected = `203.0.113.1 - coda [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13 "-" "gotest" 1007 "req12345"` + "\n"
+	if actual != expected {
+		t.Errorf("Log output was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+}
+
+func TestLoggingHandlerBatching(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "Hello, world!")
+		}),
+		out,
+		WithFormatter(Common),
+		WithBatching(1024, time.Hour),
+	)
+	logger.clock = mockClock()
+	logger.Start()
+	defer logger.Stop(context.Background())
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RemoteAddr = "203.0.113.1:5150"
+	r.RequestURI = "/"
+	r.Proto = "HTTP/1.1"
+
+	for i := 0; i < 3; i++ {
+		logger.ServeHTTP(discardWriter{}, r)
+	}
+
+	// Nothing should be written until the batch is flushed.
+	if out.Len() != 0 {
+		t.Errorf("Log output was written early: %q", out.String())
+	}
+
+	logger.Flush()
+
+	actual := out.String()
+	line := `203.0.113.1 - - [03/Jun/2014:16:45:23 +0000] "GET / HTTP/1.1" 200 13` + "\n"
+	expected := `203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13` + "\n" + line + line
 	if actual != expected {
 		t.Errorf("Log output was \n`%s`\n, but expected \n`%s`", actual, expected)
 	}
 }
+
+type discardWriter http.Header
+
+func (w discardWriter) Header() http.Header         { return http.Header(w) }
+func (w discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardWriter) WriteHeader(int)             {}
+
+func BenchmarkLoggingHandler(b *testing.B) {
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "Hello, world!")
+		}),
+		ioutil.Discard,
+	)
+	logger.Start()
+	defer logger.Stop(context.Background())
+
+	r, err := http.NewRequest("GET", "http://example.com/hello?name=world", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	r.RemoteAddr = "203.0.113.1:5150"
+	r.RequestURI = "/hello?name=world"
+	r.Header.Set("User-Agent", "gotest")
+	r.Header.Set("X-Request-Id", "req12345")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		w := discardWriter{}
+		for pb.Next() {
+			logger.ServeHTTP(w, r)
+		}
+	})
+}
+
+type blockingWriter chan struct{}
+
+func (w blockingWriter) Write(b []byte) (int, error) {
+	<-w
+	return len(b), nil
+}
+
+func TestLoggingHandlerStop(t *testing.T) {
+	block := make(blockingWriter)
+	defer close(block)
+
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		block,
+		WithBufferSize(2),
+	)
+	logger.Start()
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One line for the stuck writer, and two for the buffer.
+	for i := 0; i < 3; i++ {
+		logger.ServeHTTP(discardWriter{}, r)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	n, err := logger.Stop(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Error was %v, but expected a timeout", err)
+	}
+
+	if n != 3 {
+		t.Errorf("Lost %d lines, but expected 3", n)
+	}
+
+	// Requests served after stopping are dropped, not blocked.
+	counters, _ := metrics.Snapshot()
+	before := counters["HTTP.Log.Dropped"]
+
+	logger.ServeHTTP(discardWriter{}, r)
+
+	counters, _ = metrics.Snapshot()
+	if v := counters["HTTP.Log.Dropped"] - before; v != 1 {
+		t.Errorf("Dropped %d lines, but expected 1", v)
+	}
+}
+
+func TestWithBufferSizeMinimum(t *testing.T) {
+	for _, n := range []int{-1, 0} {
+		out := bytes.NewBuffer(nil)
+		logger := Wrap(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+			out,
+			WithBufferSize(n),
+			WithOverflowPolicy(DropOldest),
+		)
+
+		if logger.size != 1 {
+			t.Errorf("Buffer size for %d was %d, but expected 1", n, logger.size)
+		}
+
+		// Without a writer running, this would spin forever on an unbuffered
+		// queue.
+		r := httptest.NewRequest("GET", "/", nil)
+		logger.ServeHTTP(discardWriter{}, r)
+		logger.ServeHTTP(discardWriter{}, r)
+
+		logger.Start()
+		logger.Stop(context.Background())
+
+		if strings.Count(out.String(), "\n") != 1 {
+			t.Errorf("Log was %q, but expected one line", out.String())
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var commonLine = regexp.MustCompile(`^(\S+) \S+ ("(?:[^"\\]|\\.)*"|\S+) \[([^\]]+)\] "(\S+) (.*?) (\S+)" (\d{3}) (\d+|-)`)
+
+// ParseCombined parses a line written by the Combined or Common formatters,
+// including the request duration, request ID, sample rate, and fields which
+// Combined adds to the standard format, if they're present. The returned entry
+// has no Request or ResponseHeader, its Start time is in UTC and only accurate
+// to the second, and its Duration is only accurate to the millisecond.
+func ParseCombined(line string) (*Entry, error) {
+	line = strings.TrimRight(line, "\r\n")
+
+	m := commonLine.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("logging: malformed log line %q", line)
+	}
+
+	start, err := time.Parse(apacheFormat, m[3])
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{
+		Start:      start.UTC(),
+		RemoteAddr: m[1],
+		Method:     m[4],
+		RequestURI: m[5],
+		Proto:      m[6],
+	}
+
+	if strings.HasPrefix(m[2], `"`) {
+		if err := unquote(m[2], &e.User); err != nil {
+			return nil, err
+		}
+	} else if m[2] != "-" {
+		e.User = m[2]
+	}
+
+	e.Status, _ = strconv.Atoi(m[7])
+	if m[8] != "-" {
+		e.Size, _ = strconv.ParseInt(m[8], 10, 64)
+	}
+
+	rest := line[len(m[0]):]
+	fields := []func(s string) error{
+		func(s string) error { return unquote(s, &e.Referer) },
+		func(s string) error { return unquote(s, &e.UserAgent) },
+		func(s string) error {
+			ms, err := strconv.ParseInt(s, 10, 64)
+			e.Duration = time.Duration(ms) * time.Millisecond
+			return err
+		},
+		func(s string) error { return unquote(s, &e.RequestID) },
+		func(s string) error {
+			var err error
+			e.SampleRate, err = strconv.ParseFloat(s, 64)
+			return err
+		},
+	}
+
+	for rest != "" {
+		if rest[0] != ' ' {
+			return nil, fmt.Errorf("logging: malformed log line %q", line)
+		}
+		rest = rest[1:]
+
+		var token string
+		token, rest, err = nextToken(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		// Fields added by handlers are key="value" pairs, and come last.
+		if i := strings.Index(token, `="`); i > 0 {
+			var f Field
+			f.Key = token[:i]
+			if err := unquote(token[i+1:], &f.Value); err != nil {
+				return nil, err
+			}
+			e.Fields = append(e.Fields, f)
+			fields = nil
+			continue
+		}
+
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("logging: unexpected %q in log line", token)
+		}
+
+		if err := fields[0](token); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+	}
+
+	if e.Referer == "-" {
+		e.Referer = ""
+	}
+
+	if e.UserAgent == "-" {
+		e.UserAgent = ""
+	}
+
+	return e, nil
+}
+
+// nextToken returns the token at the start of s, which ends at the next space
+// outside of a quoted string, and the rest of s.
+func nextToken(s string) (string, string, error) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ' ':
+			if !quoted {
+				return s[:i], s[i:], nil
+			}
+		}
+	}
+
+	if quoted {
+		return "", "", errors.New("logging: unterminated string in log line")
+	}
+	return s, "", nil
+}
+
+func unquote(s string, v *string) error {
+	u, err := strconv.Unquote(s)
+	if err != nil {
+		return fmt.Errorf("logging: malformed string %s in log line", s)
+	}
+	*v = u
+	return nil
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCombined(t *testing.T) {
+	e := testEntry()
+	e.TimeToFirstByte = 0
+	e.User = "coda"
+	e.Referer = "http://example.com/"
+	e.SampleRate = 0.01
+	e.Fields = []Field{{Key: "tenant", Value: "acme \"corp\""}}
+
+	line := string(Combined.Format(nil, e))
+	e.Start = e.Start.Truncate(time.Second)
+
+	actual, err := ParseCombined(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(actual, e) {
+		t.Errorf("Was \n%+v\n, but expected \n%+v", actual, e)
+	}
+}
+
+func TestParseCombinedUser(t *testing.T) {
+	for _, user := range []string{"CN=John Smith", "john smith\n5.6.7.8 - admin", `"quoted"`} {
+		e := testEntry()
+		e.User = user
+
+		actual, err := ParseCombined(string(Common.Format(nil, e)))
+		if err != nil {
+			t.Errorf("%q: %s", user, err)
+			continue
+		}
+
+		if actual.User != user {
+			t.Errorf("User was %q, but expected %q", actual.User, user)
+		}
+	}
+}
+
+func TestParseCombinedVariants(t *testing.T) {
+	tests := map[string]Entry{
+		`203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 -`: {
+			RemoteAddr: "203.0.113.1", Method: "GET", RequestURI: "/", Proto: "HTTP/1.1", Status: 200,
+		},
+		`203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13 "-" "curl"`: {
+			RemoteAddr: "203.0.113.1", Method: "GET", RequestURI: "/", Proto: "HTTP/1.1", Status: 200, Size: 13,
+			UserAgent: "curl",
+		},
+		`203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13 tenant="acme"`: {
+			RemoteAddr: "203.0.113.1", Method: "GET", RequestURI: "/", Proto: "HTTP/1.1", Status: 200, Size: 13,
+			Fields: []Field{{Key: "tenant", Value: "acme"}},
+		},
+		`203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13 "-" "-" 5 ""`: {
+			RemoteAddr: "203.0.113.1", Method: "GET", RequestURI: "/", Proto: "HTTP/1.1", Status: 200, Size: 13,
+			Duration: 5 * time.Millisecond,
+		},
+	}
+
+	for line, expected := range tests {
+		expected.Start = time.Date(2014, 6, 3, 16, 45, 22, 0, time.UTC)
+
+		actual, err := ParseCombined(line)
+		if err != nil {
+			t.Errorf("%q: %s", line, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(*actual, expected) {
+			t.Errorf("%q was \n%+v\n, but expected \n%+v", line, *actual, expected)
+		}
+	}
+}
+
+func TestParseCombinedErrors(t *testing.T) {
+	lines := []string{
+		``,
+		`203.0.113.1 - - [yesterday] "GET / HTTP/1.1" 200 13`,
+		`203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13 "-" "unterminated`,
+		`203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13 "-" "curl" soon`,
+		`203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 200 13 "-" "curl" 1 "id" 0.5 extra`,
+	}
+
+	for _, line := range lines {
+		if e, err := ParseCombined(line); err == nil {
+			t.Errorf("%q should not have parsed, but was %+v", line, e)
+		}
+	}
+}
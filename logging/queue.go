@@ -0,0 +1,281 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codahale/metrics"
+)
+
+// An OverflowPolicy determines what a LoggingHandler does with a log line when
+// its buffer is full.
+type OverflowPolicy int
+
+const (
+	// Block waits for room in the buffer, stalling the request until the writer
+	// catches up.
+	Block OverflowPolicy = iota
+
+	// DropNewest discards the line being logged.
+	DropNewest
+
+	// DropOldest discards the oldest buffered line to make room for the line
+	// being logged.
+	DropOldest
+)
+
+// A LineWriter is a Writer which would rather be given log lines one at a time,
+// along with the status of the response each describes, than in batches.
+type LineWriter interface {
+	io.Writer
+
+	// WriteLine writes a single log line, including its trailing newline.
+	WriteLine(line []byte, status int) error
+}
+
+// A queue buffers log lines and writes them to a Writer in batches on a
+// separate goroutine.
+type queue struct {
+	w             io.Writer
+	overflow      OverflowPolicy
+	batchSize     int
+	flushInterval time.Duration
+	lines         chan *record
+	flushes       chan chan struct{}
+
+	// pending is the number of lines enqueued but not yet written.
+	pending int64
+
+	// Enqueuers hold a read lock, so that once stop holds the write lock and
+	// sets stopped, nobody else will add to lines.
+	m        sync.RWMutex
+	stopped  bool
+	stopOnce sync.Once
+	stopping chan struct{} // closed when stop is called
+	draining chan struct{} // closed once nothing more can be enqueued
+	quit     chan struct{} // closed once everything has been written
+}
+
+func newQueue(w io.Writer, size int, overflow OverflowPolicy, batchSize int, flushInterval time.Duration) *queue {
+	return &queue{
+		w:             w,
+		overflow:      overflow,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		lines:         make(chan *record, size),
+		flushes:       make(chan chan struct{}),
+		stopping:      make(chan struct{}),
+		draining:      make(chan struct{}),
+		quit:          make(chan struct{}),
+	}
+}
+
+func (q *queue) start() {
+	go q.run()
+}
+
+func (q *queue) run() {
+	var tick <-chan time.Time
+	if q.flushInterval > 0 {
+		ticker := time.NewTicker(q.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	lw, _ := q.w.(LineWriter)
+	batch := make([]byte, 0, q.batchSize)
+	batched := int64(0)
+	add := func(r *record) {
+		atomic.AddInt64(&queued, -1)
+		if lw != nil {
+			_ = lw.WriteLine(r.b, r.status)
+			atomic.AddInt64(&q.pending, -1)
+		} else {
+			batch = append(batch, r.b...)
+			batched++
+		}
+		releaseRecord(r)
+	}
+	write := func() {
+		if len(batch) > 0 {
+			_, _ = q.w.Write(batch)
+			atomic.AddInt64(&q.pending, -batched)
+			batch = batch[:0]
+			batched = 0
+		}
+	}
+	drain := func() {
+		for n := len(q.lines); n > 0; n-- {
+			select {
+			case r := <-q.lines:
+				add(r)
+			default:
+				n = 0 // an enqueuer dropped the oldest lines
+			}
+		}
+		write()
+	}
+
+	for {
+		select {
+		case r := <-q.lines:
+			add(r)
+
+			// Without a flush interval, write as soon as we run out of lines.
+			if len(batch) >= q.batchSize || (tick == nil && len(q.lines) == 0) {
+				write()
+			}
+		case <-tick:
+			write()
+		case done := <-q.flushes:
+			drain()
+			close(done)
+		case <-q.draining:
+			drain()
+			close(q.quit)
+			return
+		}
+	}
+}
+
+// flush blocks until every line enqueued before it was called has been
+// written.
+func (q *queue) flush() {
+	done := make(chan struct{})
+	select {
+	case q.flushes <- done:
+		<-done
+	case <-q.draining:
+	}
+}
+
+// close stops accepting lines.
+func (q *queue) close() {
+	q.stopOnce.Do(func() {
+		close(q.stopping) // wake blocked enqueuers
+
+		q.m.Lock()
+		q.stopped = true
+		q.m.Unlock()
+
+		close(q.draining)
+	})
+}
+
+// wait waits for a closed queue to write the lines already enqueued, or for
+// the context to be done. It returns the number of lines which were enqueued but
+// not written.
+func (q *queue) wait(ctx context.Context) (int, error) {
+	select {
+	case <-q.quit:
+		return 0, nil
+	case <-ctx.Done():
+	}
+
+	// Don't count a queue which finished just in time as having lost lines.
+	select {
+	case <-q.quit:
+		return 0, nil
+	default:
+		return int(atomic.LoadInt64(&q.pending)), ctx.Err()
+	}
+}
+
+func (q *queue) enqueue(line *record) {
+	q.m.RLock()
+	defer q.m.RUnlock()
+
+	if q.stopped {
+		q.drop(line)
+		return
+	}
+
+	atomic.AddInt64(&queued, 1)
+	atomic.AddInt64(&q.pending, 1)
+
+	switch q.overflow {
+	case DropNewest:
+		select {
+		case q.lines <- line:
+		default:
+			q.unqueue(line)
+		}
+	case DropOldest:
+		for {
+			select {
+			case q.lines <- line:
+				return
+			default:
+			}
+
+			// Make room, unless the writer beat us to it.
+			select {
+			case old := <-q.lines:
+				q.unqueue(old)
+			default:
+			}
+		}
+	default:
+		select {
+		case q.lines <- line:
+		case <-q.stopping:
+			q.unqueue(line)
+		}
+	}
+}
+
+// unqueue drops a line which was counted as enqueued.
+func (q *queue) unqueue(line *record) {
+	atomic.AddInt64(&queued, -1)
+	atomic.AddInt64(&q.pending, -1)
+	q.drop(line)
+}
+
+func (q *queue) drop(line *record) {
+	dropped.Add()
+	releaseRecord(line)
+}
+
+// A record is a formatted log line and the status of the response it
+// describes.
+type record struct {
+	b      []byte
+	status int
+}
+
+// Formatting a line takes a record from the pool, which goes back once the
+// line has been copied into a batch or written.
+var records = sync.Pool{
+	New: func() interface{} {
+		return &record{b: make([]byte, 0, 512)}
+	},
+}
+
+func getRecord() *record {
+	r := records.Get().(*record)
+	r.b = r.b[:0]
+	return r
+}
+
+func releaseRecord(r *record) {
+	// Don't hang on to the odd enormous line.
+	if cap(r.b) <= 64*1024 {
+		records.Put(r)
+	}
+}
+
+var (
+	dropped = metrics.Counter("HTTP.Log.Dropped")
+
+	// the number of lines buffered across all handlers
+	queued int64
+)
+
+func init() {
+	metrics.Gauge("HTTP.Log.QueueDepth").SetFunc(func() int64 {
+		return atomic.LoadInt64(&queued)
+	})
+}
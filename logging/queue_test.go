@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/codahale/metrics"
+)
+
+func TestQueueDropNewest(t *testing.T) {
+	testOverflow(t, DropNewest, "ab")
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	testOverflow(t, DropOldest, "bc")
+}
+
+func testOverflow(t *testing.T, policy OverflowPolicy, expected string) {
+	counters, _ := metrics.Snapshot()
+	before := counters["HTTP.Log.Dropped"]
+
+	out := bytes.NewBuffer(nil)
+	q := newQueue(out, 2, policy, 1024, 0)
+	q.enqueue(line("a"))
+	q.enqueue(line("b"))
+
+	_, gauges := metrics.Snapshot()
+	if v := gauges["HTTP.Log.QueueDepth"]; v != 2 {
+		t.Errorf("Queue depth was %d, but expected 2", v)
+	}
+
+	q.enqueue(line("c"))
+
+	// Only start writing once the buffer has overflowed.
+	q.start()
+	q.close()
+	q.wait(context.Background())
+
+	if actual := out.String(); actual != expected {
+		t.Errorf("Output was %q, but expected %q", actual, expected)
+	}
+
+	counters, gauges = metrics.Snapshot()
+	if v := counters["HTTP.Log.Dropped"] - before; v != 1 {
+		t.Errorf("Dropped %d lines, but expected 1", v)
+	}
+
+	if v := gauges["HTTP.Log.QueueDepth"]; v != 0 {
+		t.Errorf("Queue depth was %d, but expected 0", v)
+	}
+}
+
+func line(s string) *record {
+	r := getRecord()
+	r.b = append(r.b, s...)
+	return r
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/codahale/http-handlers/internal/response"
+)
+
+// responseWrapper records the status, size, and time to first byte of a
+// response, and optionally the time spent writing it and the beginning of its
+// body.
+type responseWrapper struct {
+	response.Recorder
+	clock      clock
+	firstByte  time.Time
+	timeWrites bool
+	writeTime  time.Duration
+	capture    *capped
+}
+
+func newResponseWrapper(w http.ResponseWriter, c clock) *responseWrapper {
+	return &responseWrapper{Recorder: response.NewRecorder(w), clock: c}
+}
+
+func (w *responseWrapper) Write(b []byte) (int, error) {
+	w.writing()
+	start := w.now()
+	n, err := w.Recorder.Write(b)
+	w.wrote(start)
+	if w.capture != nil {
+		_, _ = w.capture.Write(b[:n])
+	}
+	return n, err
+}
+
+func (w *responseWrapper) ReadFrom(r io.Reader) (int64, error) {
+	w.writing()
+	if w.capture != nil {
+		r = io.TeeReader(r, w.capture)
+	}
+	start := w.now()
+	n, err := w.Recorder.ReadFrom(r)
+	w.wrote(start)
+	return n, err
+}
+
+// writing records the time to first byte, if this is the first write of the
+// response body.
+func (w *responseWrapper) writing() {
+	if w.firstByte.IsZero() {
+		w.firstByte = w.clock()
+	}
+}
+
+// now returns the current time if writes are being timed.
+func (w *responseWrapper) now() time.Time {
+	if !w.timeWrites {
+		return time.Time{}
+	}
+	return w.clock()
+}
+
+// wrote records the time spent on a write which started at the given time.
+func (w *responseWrapper) wrote(start time.Time) {
+	if w.timeWrites {
+		w.writeTime += w.clock().Sub(start)
+	}
+}
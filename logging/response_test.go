@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fancyWriter struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+	pushed   string
+	closed   chan bool
+}
+
+func (w *fancyWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(w.ResponseRecorder, r)
+}
+
+func (w *fancyWriter) Push(target string, _ *http.PushOptions) error {
+	w.pushed = target
+	return nil
+}
+
+func (w *fancyWriter) CloseNotify() <-chan bool {
+	return w.closed
+}
+
+func newWrapper(w http.ResponseWriter) *responseWrapper {
+	return newResponseWrapper(w, mockClock())
+}
+
+func TestResponseWrapperImplicitStatus(t *testing.T) {
+	w := newWrapper(httptest.NewRecorder())
+
+	if _, err := w.Write([]byte("Hello, ")); err != nil {
+		t.Fatal(err)
+	}
+	w.WriteHeader(500) // too late, and ignored by net/http too
+	if _, err := w.Write([]byte("world!")); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Status() != 200 {
+		t.Errorf("Status was %d, but expected 200", w.Status())
+	}
+
+	if w.Size() != 13 {
+		t.Errorf("Size was %d, but expected 13", w.Size())
+	}
+
+	expected := time.Date(2014, 6, 3, 16, 45, 22, 36e6, time.UTC)
+	if !w.firstByte.Equal(expected) {
+		t.Errorf("First byte was at %v, but expected %v", w.firstByte, expected)
+	}
+}
+
+func TestResponseWrapperInformationalStatus(t *testing.T) {
+	w := newWrapper(httptest.NewRecorder())
+	w.WriteHeader(http.StatusEarlyHints)
+	w.WriteHeader(http.StatusNotFound)
+
+	if w.Status() != 404 {
+		t.Errorf("Status was %d, but expected 404", w.Status())
+	}
+
+	if !w.firstByte.IsZero() {
+		t.Errorf("First byte was at %v, but expected none", w.firstByte)
+	}
+}
+
+func TestResponseWrapperPassThrough(t *testing.T) {
+	fancy := &fancyWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		closed:           make(chan bool),
+	}
+	w := newWrapper(fancy)
+
+	n, err := w.ReadFrom(strings.NewReader("Hello, world!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fancy.readFrom || n != 13 || w.Size() != 13 {
+		t.Errorf("ReadFrom wasn't passed through: %v/%d/%d", fancy.readFrom, n, w.Size())
+	}
+
+	if err := w.Push("/style.css", nil); err != nil || fancy.pushed != "/style.css" {
+		t.Errorf("Push wasn't passed through: %v/%q", err, fancy.pushed)
+	}
+
+	if w.CloseNotify() != fancy.closed {
+		t.Error("CloseNotify wasn't passed through")
+	}
+
+	w.Flush()
+	if !fancy.Flushed {
+		t.Error("Flush wasn't passed through")
+	}
+}
+
+func TestResponseWrapperFallbacks(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newWrapper(struct{ http.ResponseWriter }{rec})
+
+	n, err := w.ReadFrom(strings.NewReader("Hello, world!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 13 || rec.Body.String() != "Hello, world!" {
+		t.Errorf("ReadFrom wrote %d bytes: %q", n, rec.Body.String())
+	}
+
+	if err := w.Push("/style.css", nil); err != http.ErrNotSupported {
+		t.Errorf("Push returned %v, but expected ErrNotSupported", err)
+	}
+
+	if _, _, err := w.Hijack(); err == nil {
+		t.Error("Hijack should have failed")
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// WithExcludedPaths returns an Option which doesn't log requests whose paths
+// match any of the given patterns, in the syntax of path.Match, such as
+// "/healthz" or "/*.ico". As with path.Match, a * only matches within one
+// segment of the path, so "/static/*" matches "/static/app.js" but not
+// "/static/js/app.js". A pattern ending in "/**", such as "/static/**",
+// matches everything under the paths its beginning matches. It panics if a
+// pattern is malformed.
+func WithExcludedPaths(patterns ...string) Option {
+	for _, p := range patterns {
+		if _, err := path.Match(strings.TrimSuffix(p, "/**"), ""); err != nil {
+			panic("logging: bad path pattern " + p)
+		}
+	}
+
+	return func(al *LoggingHandler) {
+		al.excludedPaths = append(al.excludedPaths, patterns...)
+	}
+}
+
+// WithExcludedUserAgents returns an Option which doesn't log requests whose
+// User-Agent headers contain any of the given strings, such as
+// "ELB-HealthChecker".
+func WithExcludedUserAgents(substrings ...string) Option {
+	return func(al *LoggingHandler) {
+		al.excludedAgents = append(al.excludedAgents, substrings...)
+	}
+}
+
+// excluded returns whether or not the given request should go unlogged.
+func (al *LoggingHandler) excluded(r *http.Request) bool {
+	if len(al.excludedPaths) > 0 {
+		p := requestPath(r)
+		for _, pattern := range al.excludedPaths {
+			if matchPath(pattern, p) {
+				return true
+			}
+		}
+	}
+
+	if len(al.excludedAgents) > 0 {
+		ua := r.UserAgent()
+		for _, s := range al.excludedAgents {
+			if strings.Contains(ua, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPath returns whether or not the path matches the pattern, as described
+// by WithExcludedPaths.
+func matchPath(pattern, p string) bool {
+	prefix := strings.TrimSuffix(pattern, "/**")
+	if prefix == pattern {
+		ok, _ := path.Match(pattern, p)
+		return ok
+	}
+
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' {
+			if ok, _ := path.Match(prefix, p[:i]); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithRewrite returns an Option which rewrites the URIs of requests before
+// they're logged, applying the given functions in order.
+func WithRewrite(rewrites ...func(uri string) string) Option {
+	return func(al *LoggingHandler) {
+		al.rewrites = append(al.rewrites, rewrites...)
+	}
+}
+
+func (al *LoggingHandler) rewrite(uri string) string {
+	for _, f := range al.rewrites {
+		uri = f(uri)
+	}
+	return uri
+}
+
+// MaskQuery returns a rewrite function for WithRewrite which replaces the values
+// of the named query parameters with "[REDACTED]", e.g. turning
+// "/reset?token=abc123&lang=en" into "/reset?token=[REDACTED]&lang=en".
+// Parameter names are case-insensitive.
+func MaskQuery(names ...string) func(uri string) string {
+	return func(uri string) string {
+		i := strings.IndexByte(uri, '?')
+		if i == -1 {
+			return uri
+		}
+
+		params := strings.Split(uri[i+1:], "&")
+		masked := false
+		for j, param := range params {
+			raw := param
+			if k := strings.IndexByte(param, '='); k != -1 {
+				raw = param[:k]
+			}
+
+			key := raw
+			if unescaped, err := url.QueryUnescape(raw); err == nil {
+				key = unescaped
+			}
+
+			for _, name := range names {
+				if strings.EqualFold(key, name) {
+					params[j] = raw + "=" + redacted
+					masked = true
+					break
+				}
+			}
+		}
+
+		if !masked {
+			return uri
+		}
+		return uri[:i+1] + strings.Join(params, "&")
+	}
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestMaskQuery(t *testing.T) {
+	mask := MaskQuery("token", "key")
+
+	tests := map[string]string{
+		"/":                               "/",
+		"/reset?lang=en":                  "/reset?lang=en",
+		"/reset?token=abc123&lang=en":     "/reset?token=[REDACTED]&lang=en",
+		"/reset?lang=en&TOKEN=abc&key=1":  "/reset?lang=en&TOKEN=[REDACTED]&key=[REDACTED]",
+		"/reset?%74oken=abc":              "/reset?%74oken=[REDACTED]",
+		"/reset?token":                    "/reset?token=[REDACTED]",
+		"/reset?tokens=abc&monkey=banana": "/reset?tokens=abc&monkey=banana",
+	}
+
+	for uri, expected := range tests {
+		if actual := mask(uri); actual != expected {
+			t.Errorf("%q was rewritten to %q, but expected %q", uri, actual, expected)
+		}
+	}
+}
+
+func TestLoggingHandlerExclusionsAndRewrites(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	served := 0
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served++
+		}),
+		buf,
+		WithFormatter(FormatterFunc(func(b []byte, e *Entry) []byte {
+			b = append(b, e.RequestURI...)
+			return append(b, '\n')
+		})),
+		WithExcludedPaths("/healthz", "/static/*"),
+		WithExcludedUserAgents("ELB-HealthChecker"),
+		WithRewrite(MaskQuery("token")),
+	)
+	logger.Start()
+
+	requests := []struct{ uri, ua string }{
+		{"/healthz", ""},
+		{"/static/app.js", ""},
+		{"/static/js/app.js", ""},
+		{"/", "ELB-HealthChecker/2.0"},
+		{"/reset?token=abc", "curl"},
+	}
+
+	for _, req := range requests {
+		r, err := http.NewRequest("GET", req.uri, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RequestURI = req.uri
+		r.Header.Set("User-Agent", req.ua)
+		logger.ServeHTTP(discardWriter{}, r)
+	}
+	logger.Flush()
+
+	if served != len(requests) {
+		t.Errorf("Served %d requests, but expected %d", served, len(requests))
+	}
+
+	// Globs don't match across slashes.
+	actual := buf.String()
+	expected := "/static/js/app.js\n/reset?token=[REDACTED]\n"
+	if actual != expected {
+		t.Errorf("Was %q, but expected %q", actual, expected)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		expected      bool
+	}{
+		{"/static/*", "/static/app.js", true},
+		{"/static/*", "/static/js/app.js", false},
+		{"/static/**", "/static/js/app.js", true},
+		{"/static/**", "/static/app.js", true},
+		{"/static/**", "/static", false},
+		{"/static/**", "/staticky/app.js", false},
+		{"/*/assets/**", "/v1/assets/css/app.css", true},
+		{"/**", "/anything/at/all", true},
+	}
+
+	for _, test := range tests {
+		if actual := matchPath(test.pattern, test.path); actual != test.expected {
+			t.Errorf("%q matching %q was %v, but expected %v", test.pattern, test.path, actual, test.expected)
+		}
+	}
+}
+
+func TestWithExcludedPathsPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("A bad pattern should have panicked")
+		}
+	}()
+	WithExcludedPaths("/[")
+}
@@ -0,0 +1,266 @@
+package logging
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A RotationPolicy determines when a RotatingFile is rotated and what happens
+// to the rotated files. Zero values disable the corresponding behavior.
+type RotationPolicy struct {
+	MaxSize    int64         // rotate before the file exceeds this many bytes
+	MaxAge     time.Duration // rotate once the file has been open this long
+	MaxBackups int           // delete all but this many rotated files
+	Compress   bool          // gzip rotated files
+}
+
+// A RotatingFile is an io.WriteCloser which appends to a file, rotating it
+// according to a RotationPolicy. Rotated files are renamed with a timestamp
+// suffix, e.g. access.log-20140603T164522.036000000.gz.
+//
+// For compatibility with logrotate and similar tools, a RotatingFile also
+// reopens its file whenever the process receives SIGHUP.
+type RotatingFile struct {
+	path   string
+	policy RotationPolicy
+	clock  clock
+
+	m      sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	hup        chan os.Signal
+	compressed sync.WaitGroup
+}
+
+// OpenRotatingFile opens the file at the given path for appending, creating it
+// if necessary, and returns a RotatingFile which writes to it.
+func OpenRotatingFile(path string, policy RotationPolicy) (*RotatingFile, error) {
+	rf := &RotatingFile{
+		path:   path,
+		policy: policy,
+		clock:  time.Now,
+		hup:    make(chan os.Signal, 1),
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	signal.Notify(rf.hup, syscall.SIGHUP)
+	go func() {
+		for _ = range rf.hup {
+			_ = rf.Reopen()
+		}
+	}()
+
+	return rf, nil
+}
+
+// Write appends b to the file, first rotating it if the policy requires.
+func (rf *RotatingFile) Write(b []byte) (int, error) {
+	rf.m.Lock()
+	defer rf.m.Unlock()
+
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rf.shouldRotate(len(b)) {
+		// If rotation fails, keep appending to the current file rather than
+		// losing lines; it'll be retried on the next write.
+		_ = rf.rotate()
+	}
+
+	n, err := rf.f.Write(b)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Rotate renames the current file and starts a new one.
+func (rf *RotatingFile) Rotate() error {
+	rf.m.Lock()
+	defer rf.m.Unlock()
+
+	if rf.f == nil {
+		return os.ErrClosed
+	}
+	return rf.rotate()
+}
+
+// Reopen closes and reopens the file, in case it has been moved.
+func (rf *RotatingFile) Reopen() error {
+	rf.m.Lock()
+	defer rf.m.Unlock()
+
+	if rf.f == nil {
+		return os.ErrClosed
+	}
+
+	// A failed rotation may have left the file closed.
+	if err := rf.f.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return rf.open()
+}
+
+// Close closes the file and waits for any rotated files to be compressed.
+func (rf *RotatingFile) Close() error {
+	rf.m.Lock()
+	defer rf.m.Unlock()
+
+	if rf.f == nil {
+		return os.ErrClosed
+	}
+
+	signal.Stop(rf.hup)
+	close(rf.hup)
+	rf.compressed.Wait()
+
+	err := rf.f.Close()
+	rf.f = nil
+	return err
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.f = f
+	rf.size = fi.Size()
+	rf.opened = rf.clock()
+	return nil
+}
+
+func (rf *RotatingFile) shouldRotate(n int) bool {
+	if rf.size == 0 {
+		return false // don't leave empty backups behind
+	}
+
+	if rf.policy.MaxSize > 0 && rf.size+int64(n) > rf.policy.MaxSize {
+		return true
+	}
+
+	return rf.policy.MaxAge > 0 && rf.clock().Sub(rf.opened) >= rf.policy.MaxAge
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+
+	backup := rf.path + "-" + rf.clock().UTC().Format(backupFormat)
+	if err := os.Rename(rf.path, backup); err != nil {
+		// Carry on with the file we had.
+		if oerr := rf.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	rf.compressed.Add(1)
+	go func() {
+		defer rf.compressed.Done()
+
+		if rf.policy.Compress {
+			_ = compress(backup)
+		}
+		rf.prune()
+	}()
+
+	return nil
+}
+
+const backupFormat = "20060102T150405.000000000"
+
+// prune deletes the oldest backups beyond MaxBackups.
+func (rf *RotatingFile) prune() {
+	if rf.policy.MaxBackups <= 0 {
+		return
+	}
+
+	backups, err := filepath.Glob(rf.path + "-*")
+	if err != nil {
+		return
+	}
+
+	// The timestamp suffixes sort chronologically, but a backup which is
+	// still being compressed shouldn't be counted twice.
+	seen := make(map[string]bool)
+	var unique []string
+	for _, b := range backups {
+		name := strings.TrimSuffix(b, ".gz")
+
+		// Leave other files which happen to share the prefix alone.
+		suffix := strings.TrimPrefix(name, rf.path+"-")
+		if _, err := time.Parse(backupFormat, suffix); err != nil {
+			continue
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+
+	for i := 0; i < len(unique)-rf.policy.MaxBackups; i++ {
+		os.Remove(unique[i])
+		os.Remove(unique[i] + ".gz")
+	}
+}
+
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,284 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func steppingClock() clock {
+	t := time.Date(2014, 6, 3, 16, 45, 22, 0, time.UTC)
+	return func() time.Time {
+		t = t.Add(time.Second)
+		return t
+	}
+}
+
+func openTestFile(t *testing.T, policy RotationPolicy) (*RotatingFile, string) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := OpenRotatingFile(path, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf.clock = steppingClock()
+	rf.opened = rf.clock()
+	return rf, path
+}
+
+func write(t *testing.T, rf *RotatingFile, s string) {
+	if _, err := rf.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func backups(t *testing.T, path string) []string {
+	names, err := filepath.Glob(path + "-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFileMaxSize(t *testing.T) {
+	rf, path := openTestFile(t, RotationPolicy{MaxSize: 10})
+
+	write(t, rf, "12345\n")
+	write(t, rf, "6789\n") // exactly 11 bytes, so rotate first
+	write(t, rf, "abcd\n")
+
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual, expected := readFile(t, path), "6789\nabcd\n"; actual != expected {
+		t.Errorf("Current file was %q, but expected %q", actual, expected)
+	}
+
+	names := backups(t, path)
+	if len(names) != 1 {
+		t.Fatalf("Expected one backup, but got %v", names)
+	}
+
+	if actual, expected := readFile(t, names[0]), "12345\n"; actual != expected {
+		t.Errorf("Backup was %q, but expected %q", actual, expected)
+	}
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	rf, path := openTestFile(t, RotationPolicy{MaxAge: time.Second})
+
+	write(t, rf, "one\n")
+	write(t, rf, "two\n")
+
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual, expected := readFile(t, path), "two\n"; actual != expected {
+		t.Errorf("Current file was %q, but expected %q", actual, expected)
+	}
+
+	if names := backups(t, path); len(names) != 1 {
+		t.Errorf("Expected one backup, but got %v", names)
+	}
+}
+
+func TestRotatingFileBackups(t *testing.T) {
+	rf, path := openTestFile(t, RotationPolicy{MaxBackups: 2, Compress: true})
+
+	for _, s := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		write(t, rf, s)
+		if err := rf.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		rf.compressed.Wait()
+	}
+
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := backups(t, path)
+	if len(names) != 2 {
+		t.Fatalf("Expected two backups, but got %v", names)
+	}
+
+	for i, expected := range []string{"three\n", "four\n"} {
+		if filepath.Ext(names[i]) != ".gz" {
+			t.Errorf("Backup %s wasn't compressed", names[i])
+			continue
+		}
+
+		f, err := os.Open(names[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := string(b); actual != expected {
+			t.Errorf("Backup %s was %q, but expected %q", names[i], actual, expected)
+		}
+	}
+}
+
+func TestRotatingFilePruneOthers(t *testing.T) {
+	rf, path := openTestFile(t, RotationPolicy{MaxBackups: 1})
+
+	others := []string{path + "-old", path + "-debug", path + "-20140603.gz"}
+	for _, name := range others {
+		if err := ioutil.WriteFile(name, []byte("other\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, s := range []string{"one\n", "two\n"} {
+		write(t, rf, s)
+		if err := rf.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		rf.compressed.Wait()
+	}
+
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range others {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("%s was pruned: %v", name, err)
+		}
+	}
+
+	var kept []string
+	for _, name := range backups(t, path) {
+		if readFile(t, name) != "other\n" {
+			kept = append(kept, name)
+		}
+	}
+
+	if len(kept) != 1 || readFile(t, kept[0]) != "two\n" {
+		t.Errorf("Expected only the latest backup, but got %v", kept)
+	}
+}
+
+func TestRotatingFileSIGHUP(t *testing.T) {
+	rf, path := openTestFile(t, RotationPolicy{})
+	defer rf.Close()
+
+	write(t, rf, "before\n")
+
+	// Pretend to be logrotate.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("File was never reopened")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	write(t, rf, "after\n")
+
+	if actual, expected := readFile(t, path+".1"), "before\n"; actual != expected {
+		t.Errorf("Old file was %q, but expected %q", actual, expected)
+	}
+
+	if actual, expected := readFile(t, path), "after\n"; actual != expected {
+		t.Errorf("New file was %q, but expected %q", actual, expected)
+	}
+}
+
+func TestRotatingFileFailedRotation(t *testing.T) {
+	rf, path := openTestFile(t, RotationPolicy{MaxSize: 10})
+	now := time.Date(2014, 6, 3, 16, 45, 22, 0, time.UTC)
+	rf.clock = func() time.Time { return now }
+
+	// Something is in the way of the backup.
+	backup := path + "-" + now.Format(backupFormat)
+	if err := os.MkdirAll(filepath.Join(backup, "obstruction"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, rf, "12345\n")
+	write(t, rf, "6789\n")
+
+	if err := rf.Rotate(); err == nil {
+		t.Error("Rotated over a non-empty directory")
+	}
+
+	if err := rf.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.RemoveAll(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, rf, "abcd\n")
+
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual, expected := readFile(t, path), "abcd\n"; actual != expected {
+		t.Errorf("Current file was %q, but expected %q", actual, expected)
+	}
+
+	if actual, expected := readFile(t, backup), "12345\n6789\n"; actual != expected {
+		t.Errorf("Backup was %q, but expected %q", actual, expected)
+	}
+}
+
+func TestRotatingFileReopenClosed(t *testing.T) {
+	rf, path := openTestFile(t, RotationPolicy{})
+	defer rf.Close()
+
+	// As if a rotation had failed to reopen the file.
+	if err := rf.f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rf.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, rf, "one\n")
+
+	if actual, expected := readFile(t, path), "one\n"; actual != expected {
+		t.Errorf("File was %q, but expected %q", actual, expected)
+	}
+}
@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// A SampleRule determines the fraction of matching requests which are logged.
+type SampleRule struct {
+	// Path matches the path of a request exactly or, if it ends in a slash,
+	// as a prefix. An empty Path matches every request.
+	Path string
+
+	// MinStatus and MaxStatus are the inclusive bounds of the response
+	// statuses the rule matches. Zero leaves a bound open.
+	MinStatus, MaxStatus int
+
+	// Rate is the fraction of matching requests which are logged, from 0 to 1.
+	Rate float64
+}
+
+func (rule SampleRule) matches(path string, status int) bool {
+	if rule.MinStatus != 0 && status < rule.MinStatus {
+		return false
+	}
+
+	if rule.MaxStatus != 0 && status > rule.MaxStatus {
+		return false
+	}
+
+	if strings.HasSuffix(rule.Path, "/") {
+		return strings.HasPrefix(path, rule.Path)
+	}
+	return rule.Path == "" || rule.Path == path
+}
+
+// WithSampling returns an Option which logs only a sample of requests, as
+// determined by the first of the given rules which matches each request.
+// Requests which match no rule are always logged. For example, to log every
+// error, no health checks, and one in a hundred successful requests:
+//
+//	logging.WithSampling(
+//		logging.SampleRule{MinStatus: 400, Rate: 1},
+//		logging.SampleRule{Path: "/healthz", Rate: 0},
+//		logging.SampleRule{MinStatus: 200, MaxStatus: 299, Rate: 0.01},
+//	)
+//
+// Requests with an X-Request-Id header are sampled deterministically, so that
+// services sampling at the same rate log the same requests: a request is
+// logged if the 64-bit FNV-1a hash of its ID, modulo one million, is less than
+// the rate times one million. Other requests are sampled at random.
+//
+// The Combined, JSON, and Logfmt formats record the rate at which a request
+// was sampled, if it was less than 1.
+func WithSampling(rules ...SampleRule) Option {
+	return func(al *LoggingHandler) {
+		al.sampling = rules
+	}
+}
+
+// sampleRate returns the rate at which requests like the given one with the
+// given response status are logged.
+func (al *LoggingHandler) sampleRate(r *http.Request, status int) float64 {
+	if len(al.sampling) == 0 {
+		return 1
+	}
+
+	for _, rule := range al.sampling {
+		if rule.matches(requestPath(r), status) {
+			return rule.Rate
+		}
+	}
+	return 1
+}
+
+// sample returns whether or not a request with the given ID should be logged
+// at the given rate.
+func sample(id string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+
+	if rate <= 0 {
+		return false
+	}
+
+	if id == "" {
+		return rand.Float64() < rate
+	}
+
+	// FNV-1a, inlined to avoid allocating.
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(id); i++ {
+		h ^= uint64(id[i])
+		h *= 1099511628211
+	}
+	return float64(h%1e6) < rate*1e6
+}
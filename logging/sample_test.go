@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSampleRuleMatches(t *testing.T) {
+	tests := []struct {
+		rule    SampleRule
+		path    string
+		status  int
+		matches bool
+	}{
+		{SampleRule{}, "/", 200, true},
+		{SampleRule{MinStatus: 400}, "/", 404, true},
+		{SampleRule{MinStatus: 400}, "/", 399, false},
+		{SampleRule{MinStatus: 200, MaxStatus: 299}, "/", 299, true},
+		{SampleRule{MinStatus: 200, MaxStatus: 299}, "/", 301, false},
+		{SampleRule{Path: "/healthz"}, "/healthz", 200, true},
+		{SampleRule{Path: "/healthz"}, "/healthz/db", 200, false},
+		{SampleRule{Path: "/static/"}, "/static/app.js", 200, true},
+		{SampleRule{Path: "/static/"}, "/static", 200, false},
+	}
+
+	for _, test := range tests {
+		if v := test.rule.matches(test.path, test.status); v != test.matches {
+			t.Errorf("%+v matching %s %d was %v, but expected %v", test.rule, test.path, test.status, v, test.matches)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("req%d", i)
+		if sample(id, 0.1) {
+			kept++
+
+			// A request sampled at a low rate is sampled at higher ones.
+			if !sample(id, 0.5) {
+				t.Errorf("%s was sampled at 0.1 but not at 0.5", id)
+			}
+		}
+
+		if sample(id, 0.1) != sample(id, 0.1) {
+			t.Errorf("%s was sampled inconsistently", id)
+		}
+	}
+
+	if kept < 900 || kept > 1100 {
+		t.Errorf("Kept %d of 10000 requests, but expected about 1000", kept)
+	}
+
+	// Another service hashing the same way makes the same decision.
+	if !sample("req12345", 0.6) || sample("req12345", 0.59) {
+		t.Error("Request req12345 should be sampled at 0.6 and not at 0.59")
+	}
+}
+
+func TestLoggingHandlerSampling(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/error" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}),
+		buf,
+		WithFormatter(Logfmt),
+		WithSampling(
+			SampleRule{MinStatus: 400, Rate: 1},
+			SampleRule{Path: "/healthz", Rate: 0},
+			SampleRule{MinStatus: 200, MaxStatus: 299, Rate: 0.6},
+		),
+	)
+	logger.clock = mockClock()
+	logger.Start()
+
+	for _, path := range []string{"/healthz", "/error", "/"} {
+		for _, id := range []string{"req12345", "req12346"} {
+			r, err := http.NewRequest("GET", path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.RequestURI = path
+			r.Header.Set(xRequestID, id)
+			logger.ServeHTTP(discardWriter{}, r)
+		}
+	}
+	logger.Flush()
+
+	var actual []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		i := strings.Index(line, " uri=")
+		actual = append(actual, line[i+1:])
+	}
+
+	expected := []string{
+		"uri=/error proto=HTTP/1.1 status=500 size=0 duration_ms=0.000 request_id=req12345",
+		"uri=/error proto=HTTP/1.1 status=500 size=0 duration_ms=0.000 request_id=req12346",
+		"uri=/ proto=HTTP/1.1 status=200 size=0 duration_ms=0.000 request_id=req12345 sample_rate=0.6",
+	}
+
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Was \n%s\n, but expected \n%s", strings.Join(actual, "\n"), strings.Join(expected, "\n"))
+	}
+}
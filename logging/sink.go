@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"io"
+	"sort"
+)
+
+// A Sink is an additional destination for a LoggingHandler's log lines, with
+// its own format and buffer, so that a slow sink doesn't hold back the others.
+// Lines are handed to sinks which drop lines when they're full before those
+// which block, so only blocking sinks can hold each other back.
+type Sink struct {
+	// Writer is where log lines are written.
+	Writer io.Writer
+
+	// Formatter formats log entries. The default is Combined.
+	Formatter Formatter
+
+	// Filter returns whether or not an entry should be written to the sink. By
+	// default, every entry logged is.
+	Filter func(e *Entry) bool
+
+	// BufferSize is the number of log lines buffered. The default is 1000.
+	BufferSize int
+
+	// Overflow determines what happens to log lines when the buffer is full.
+	// The default is Block, which stalls the request, and with it any other
+	// blocking sinks, until there's room. Sinks which may fall behind, such as
+	// remote ones, should use DropNewest or DropOldest instead.
+	Overflow OverflowPolicy
+}
+
+// WithSink returns an Option which also writes log lines to the given Sink. For
+// example, to log JSON to stdout, combined log lines to a rotating file, and
+// server errors to syslog:
+//
+//	logging.Wrap(h, os.Stdout,
+//		logging.WithFormatter(logging.JSON),
+//		logging.WithSink(logging.Sink{Writer: file}),
+//		logging.WithSink(logging.Sink{
+//			Writer:    syslog,
+//			Formatter: logging.Common,
+//			Overflow:  logging.DropNewest,
+//			Filter: func(e *logging.Entry) bool {
+//				return e.Status >= 500
+//			},
+//		}),
+//	)
+//
+// Sinks share the handler's batching settings.
+func WithSink(s Sink) Option {
+	return func(al *LoggingHandler) {
+		al.sinkConfigs = append(al.sinkConfigs, s)
+	}
+}
+
+type sink struct {
+	formatter Formatter
+	filter    func(e *Entry) bool
+	queue     *queue
+}
+
+// newSinks returns the handler's sinks, those which drop lines first, and
+// otherwise in order, starting with its own Writer, if it has one.
+func (al *LoggingHandler) newSinks() []*sink {
+	var sinks []*sink
+	if al.w != nil {
+		sinks = append(sinks, &sink{
+			formatter: al.formatter,
+			queue:     newQueue(al.w, al.size, al.overflow, al.batchSize, al.interval),
+		})
+	}
+
+	for _, s := range al.sinkConfigs {
+		if s.Formatter == nil {
+			s.Formatter = Combined
+		}
+
+		if s.BufferSize <= 0 {
+			s.BufferSize = 1000
+		}
+
+		sinks = append(sinks, &sink{
+			formatter: s.Formatter,
+			filter:    s.Filter,
+			queue:     newQueue(s.Writer, s.BufferSize, s.Overflow, al.batchSize, al.interval),
+		})
+	}
+
+	// Hand lines to the sinks which can't stall the request first.
+	sort.SliceStable(sinks, func(i, j int) bool {
+		return sinks[i].queue.overflow != Block && sinks[j].queue.overflow == Block
+	})
+	return sinks
+}
@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSinks(t *testing.T) {
+	block := make(blockingWriter)
+	defer close(block)
+
+	all := bytes.NewBuffer(nil)
+	errors := bytes.NewBuffer(nil)
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/error" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}),
+		nil,
+		WithSink(Sink{Writer: all, Formatter: Common}),
+		WithSink(Sink{
+			Writer: errors,
+			Formatter: FormatterFunc(func(b []byte, e *Entry) []byte {
+				b = append(b, e.RequestURI...)
+				return append(b, '\n')
+			}),
+			Filter: func(e *Entry) bool {
+				return e.Status >= 500
+			},
+		}),
+		// A stuck sink which drops lines doesn't hold back the others.
+		WithSink(Sink{Writer: block, BufferSize: 1, Overflow: DropNewest}),
+	)
+	logger.clock = mockClock()
+	logger.Start()
+
+	for _, path := range []string{"/", "/error", "/", "/error"} {
+		r, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoteAddr = "203.0.113.1:5150"
+		r.RequestURI = path
+		r.Proto = "HTTP/1.1"
+		logger.ServeHTTP(discardWriter{}, r)
+	}
+
+	// Stop, rather than flush, so as not to wait forever for the stuck sink.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if n, err := logger.Stop(ctx); n < 1 || err != context.DeadlineExceeded {
+		t.Errorf("Stopping lost %d lines with %v, but expected a timeout", n, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(all.String()), "\n")
+	if len(lines) != 4 {
+		t.Errorf("Wrote %d lines, but expected 4:\n%s", len(lines), all)
+	}
+
+	if actual, expected := lines[1], `203.0.113.1 - - [03/Jun/2014:16:45:23 +0000] "GET /error HTTP/1.1" 500 0`; actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+
+	if actual, expected := errors.String(), "/error\n/error\n"; actual != expected {
+		t.Errorf("Was %q, but expected %q", actual, expected)
+	}
+}
+
+func TestSinksBlockingLast(t *testing.T) {
+	block := make(blockingWriter)
+
+	fast := &syncBuffer{}
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		block,
+		WithBufferSize(1),
+		WithSink(Sink{Writer: fast, Formatter: Common, Overflow: DropNewest}),
+	)
+	logger.Start()
+
+	// The first line is stuck in the writer and the second in the buffer, so
+	// the third request blocks on the handler's own Writer.
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		for i := 0; i < 3; i++ {
+			logger.ServeHTTP(discardWriter{}, httptest.NewRequest("GET", "/", nil))
+		}
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for fast.lines() < 3 {
+		select {
+		case <-deadline:
+			t.Fatalf("The dropping sink got %d lines, but expected 3", fast.lines())
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	close(block)
+	<-served
+	logger.Stop(context.Background())
+}
+
+// syncBuffer is a Buffer which can be read while it's being written to.
+type syncBuffer struct {
+	m sync.Mutex
+	b bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) lines() int {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return strings.Count(b.b.String(), "\n")
+}
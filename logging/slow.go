@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithSlowLog returns an Option which writes a detailed record of each request
+// which takes longer than the threshold to the given Writer, separately from
+// the access log. Records are logfmt lines with a breakdown of where the time
+// went and the values of the given request headers:
+//
+//	time=2014-06-03T16:45:22.036Z remote_addr=203.0.113.1 method=POST uri=/upload status=201 duration_ms=2504.000 read_ms=1250.000 handler_ms=1001.000 ttfb_ms=2250.000 write_ms=253.000 request_id=req12345 header_content_type=image/png
+//
+// read_ms is the time spent reading the request body, write_ms the time spent
+// writing the response body, and handler_ms the rest. Slow requests are
+// recorded regardless of any sampling rules, and are buffered, batched, and
+// dropped in the same way as access log lines.
+func WithSlowLog(w io.Writer, threshold time.Duration, headers ...string) Option {
+	return func(al *LoggingHandler) {
+		s := &slowLog{
+			w:         w,
+			threshold: threshold,
+		}
+		for _, name := range headers {
+			s.headers = append(s.headers, slowHeader{
+				name: http.CanonicalHeaderKey(name),
+				key:  "header_" + strings.Replace(strings.ToLower(name), "-", "_", -1),
+			})
+		}
+		al.slow = s
+	}
+}
+
+type slowLog struct {
+	w         io.Writer
+	threshold time.Duration
+	headers   []slowHeader
+	queue     *queue
+}
+
+type slowHeader struct {
+	name string // the canonical header name
+	key  string // the logfmt key
+}
+
+// timings are the details of how long a request took which only the slow log
+// records.
+type timings struct {
+	read  time.Duration // reading the request body
+	write time.Duration // writing the response body
+}
+
+func (s *slowLog) format(b []byte, e *Entry, t timings) []byte {
+	b = append(b, "time="...)
+	b = e.Start.In(time.UTC).AppendFormat(b, isoFormat)
+	b = appendLogfmtField(b, "remote_addr", e.RemoteAddr)
+	b = appendLogfmtField(b, "user", e.User)
+	b = appendLogfmtField(b, "method", e.Method)
+	b = appendLogfmtField(b, "uri", e.RequestURI)
+	b = append(b, " status="...)
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, " duration_ms="...)
+	b = appendMillis(b, e.Duration)
+	b = append(b, " read_ms="...)
+	b = appendMillis(b, t.read)
+	b = append(b, " handler_ms="...)
+	b = appendMillis(b, e.Duration-t.read-t.write)
+	if e.TimeToFirstByte > 0 {
+		b = append(b, " ttfb_ms="...)
+		b = appendMillis(b, e.TimeToFirstByte)
+	}
+	b = append(b, " write_ms="...)
+	b = appendMillis(b, t.write)
+	b = appendLogfmtField(b, "request_id", e.RequestID)
+	if e.Request != nil {
+		for _, h := range s.headers {
+			if v := e.Request.Header[h.name]; len(v) > 0 {
+				b = appendLogfmtField(b, h.key, strings.Join(v, ", "))
+			}
+		}
+	}
+	b = appendLogfmtFields(b, e.Fields)
+	return append(b, '\n')
+}
+
+// A timedBody records how long was spent reading a request body.
+type timedBody struct {
+	io.ReadCloser
+	clock   clock
+	elapsed time.Duration
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	start := b.clock()
+	n, err := b.ReadCloser.Read(p)
+	b.elapsed += b.clock().Sub(start)
+	return n, err
+}
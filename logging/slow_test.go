@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowLog(t *testing.T) {
+	access := bytes.NewBuffer(nil)
+	slow := bytes.NewBuffer(nil)
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "POST" {
+				if _, err := ioutil.ReadAll(r.Body); err != nil {
+					t.Error(err)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte("ok"))
+			}
+		}),
+		access,
+		WithFormatter(Common),
+		WithSlowLog(slow, 5*time.Second, "Content-Type", "X-Missing"),
+	)
+	logger.clock = steppingClock()
+	logger.Start()
+
+	post, err := http.NewRequest("POST", "/upload", strings.NewReader("image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.RemoteAddr = "203.0.113.1:5150"
+	post.RequestURI = "/upload"
+	post.Header.Set("Content-Type", "image/png")
+	post.Header.Set(xRequestID, "req12345")
+
+	get, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get.RemoteAddr = "203.0.113.1:5150"
+	get.RequestURI = "/"
+
+	logger.ServeHTTP(discardWriter{}, post)
+	logger.ServeHTTP(discardWriter{}, get)
+	logger.Flush()
+
+	if n := strings.Count(access.String(), "\n"); n != 2 {
+		t.Errorf("Logged %d requests, but expected 2", n)
+	}
+
+	// Each call to the clock takes a second: two reads of the body, the first
+	// byte, and a write.
+	actual := slow.String()
+	expected := "time=2014-06-03T16:45:23.000Z remote_addr=203.0.113.1 method=POST uri=/upload status=201 duration_ms=8000.000 read_ms=2000.000 handler_ms=5000.000 ttfb_ms=5000.000 write_ms=1000.000 request_id=req12345 header_content_type=image/png\n"
+	if actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+}
@@ -0,0 +1,301 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A Facility is a syslog facility.
+type Facility int
+
+// Syslog facilities.
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	_ // NTP
+	_ // log audit
+	_ // log alert
+	_ // clock
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// A Severity is a syslog severity.
+type Severity int
+
+// Syslog severities.
+const (
+	SeverityEmerg Severity = iota
+	SeverityAlert
+	SeverityCrit
+	SeverityErr
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+// A SyslogFormat is a syslog message format.
+type SyslogFormat int
+
+const (
+	// RFC3164 is the traditional BSD syslog format.
+	RFC3164 SyslogFormat = iota
+
+	// RFC5424 is the modern syslog format.
+	RFC5424
+)
+
+// A SyslogConfig describes how to connect to a syslog daemon and what to send
+// it.
+type SyslogConfig struct {
+	// Network is "unixgram", "udp", or "tcp", or empty for the local syslog
+	// daemon. Messages sent over TCP are framed by octet counting.
+	Network string
+
+	// Addr is the address of the syslog daemon.
+	Addr string
+
+	// Format is the format of syslog messages. The default is RFC3164.
+	Format SyslogFormat
+
+	// Facility is the facility of syslog messages. The default is
+	// FacilityLocal0; log lines are not kernel messages.
+	Facility Facility
+
+	// Severity returns the severity of a log line given the status of the
+	// response it describes. The default is DefaultSeverity.
+	Severity func(status int) Severity
+
+	// Tag identifies the program logging the messages. The default is the
+	// program's name.
+	Tag string
+
+	// Hostname is the name of the host logging the messages. The default is
+	// the host's name.
+	Hostname string
+
+	// DialTimeout and WriteTimeout limit how long connecting to the daemon
+	// and sending it a message may take, so that a hung daemon doesn't stall
+	// logging. The defaults are five seconds each.
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// DefaultSeverity logs server errors as SeverityErr, client errors as
+// SeverityWarning, and everything else as SeverityInfo.
+func DefaultSeverity(status int) Severity {
+	switch {
+	case status >= 500:
+		return SeverityErr
+	case status >= 400:
+		return SeverityWarning
+	}
+	return SeverityInfo
+}
+
+// A SyslogWriter is a LineWriter which sends each log line to a syslog daemon
+// as a separate message. If writing a message fails or times out, it
+// reconnects and tries once more.
+type SyslogWriter struct {
+	config SyslogConfig
+	clock  clock
+	pid    string
+
+	m    sync.Mutex
+	conn net.Conn
+	buf  []byte
+}
+
+// DialSyslog connects to the syslog daemon described by the given config.
+func DialSyslog(config SyslogConfig) (*SyslogWriter, error) {
+	if config.Facility == FacilityKern {
+		config.Facility = FacilityLocal0
+	}
+
+	if config.Severity == nil {
+		config.Severity = DefaultSeverity
+	}
+
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = 5 * time.Second
+	}
+
+	if config.Tag == "" {
+		config.Tag = filepath.Base(os.Args[0])
+	}
+
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+		if config.Hostname == "" {
+			config.Hostname = "-"
+		}
+	}
+
+	w := &SyslogWriter{
+		config: config,
+		clock:  time.Now,
+		pid:    strconv.Itoa(os.Getpid()),
+	}
+
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write sends each line in b as a message with the severity of a successful
+// response.
+func (w *SyslogWriter) Write(b []byte) (int, error) {
+	for _, line := range bytes.SplitAfter(b, []byte{'\n'}) {
+		if len(line) > 0 {
+			if err := w.WriteLine(line, http.StatusOK); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(b), nil
+}
+
+// WriteLine sends the given line as a message with the severity determined by
+// the response status.
+func (w *SyslogWriter) WriteLine(line []byte, status int) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	var offset int
+	w.buf, offset = w.format(w.buf[:0], bytes.TrimRight(line, "\n"), w.config.Severity(status))
+	msg := w.buf[offset:]
+
+	if w.conn != nil {
+		if err := w.send(msg); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	if err := w.connect(); err != nil {
+		return err
+	}
+
+	return w.send(msg)
+}
+
+// send writes a message to the connection, giving up after the write timeout.
+func (w *SyslogWriter) send(msg []byte) error {
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.config.WriteTimeout)); err != nil {
+		return err
+	}
+	_, err := w.conn.Write(msg)
+	return err
+}
+
+// Close closes the connection to the syslog daemon.
+func (w *SyslogWriter) Close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) connect() error {
+	if w.config.Network != "" {
+		conn, err := net.DialTimeout(w.config.Network, w.config.Addr, w.config.DialTimeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+		return nil
+	}
+
+	for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+		if conn, err := net.DialTimeout("unixgram", path, w.config.DialTimeout); err == nil {
+			w.conn = conn
+			return nil
+		}
+	}
+	return errors.New("logging: unable to connect to the local syslog daemon")
+}
+
+// format appends a syslog message to b, returning the extended buffer and the
+// offset at which the message starts.
+func (w *SyslogWriter) format(b, msg []byte, severity Severity) ([]byte, int) {
+	// Stream transports need framing, by octet counting (RFC 6587).
+	framed := false
+	switch w.config.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		framed = true
+		b = append(b, "0000000000 "...)
+	}
+	start := len(b)
+
+	b = append(b, '<')
+	b = strconv.AppendInt(b, int64(w.config.Facility)*8+int64(severity), 10)
+	b = append(b, '>')
+
+	now := w.clock()
+	if w.config.Format == RFC5424 {
+		b = append(b, "1 "...)
+		b = now.UTC().AppendFormat(b, "2006-01-02T15:04:05.000000Z07:00")
+		b = append(b, ' ')
+		b = append(b, w.config.Hostname...)
+		b = append(b, ' ')
+		b = append(b, w.config.Tag...)
+		b = append(b, ' ')
+		b = append(b, w.pid...)
+		b = append(b, " - - "...) // no MSGID or structured data
+	} else {
+		b = now.AppendFormat(b, time.Stamp)
+		b = append(b, ' ')
+		b = append(b, w.config.Hostname...)
+		b = append(b, ' ')
+		b = append(b, w.config.Tag...)
+		b = append(b, '[')
+		b = append(b, w.pid...)
+		b = append(b, "]: "...)
+	}
+	b = append(b, msg...)
+
+	if !framed {
+		return b, start
+	}
+
+	// Overwrite the end of the placeholder with the real length.
+	n := strconv.Itoa(len(b) - start)
+	offset := start - len(n) - 1
+	copy(b[offset:], n)
+	return b, offset
+}
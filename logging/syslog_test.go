@@ -0,0 +1,245 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dialTestSyslog(t *testing.T, config SyslogConfig) *SyslogWriter {
+	config.Tag = "test"
+	config.Hostname = "host"
+
+	w, err := DialSyslog(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.clock = mockClock()
+	return w
+}
+
+func readDatagram(t *testing.T, conn net.PacketConn) string {
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b[:n])
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := dialTestSyslog(t, SyslogConfig{
+		Network: "udp",
+		Addr:    conn.LocalAddr().String(),
+		Format:  RFC5424,
+	})
+	defer w.Close()
+
+	if err := w.WriteLine([]byte("GET / 500\n"), 500); err != nil {
+		t.Fatal(err)
+	}
+
+	actual := readDatagram(t, conn)
+	expected := fmt.Sprintf("<131>1 2014-06-03T16:45:22.036000Z host test %d - - GET / 500", os.Getpid())
+	if actual != expected {
+		t.Errorf("Message was %q, but expected %q", actual, expected)
+	}
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := dialTestSyslog(t, SyslogConfig{
+		Network:  "unixgram",
+		Addr:     path,
+		Facility: FacilityDaemon,
+	})
+	defer w.Close()
+
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}),
+		w,
+		WithFormatter(Common),
+	)
+	logger.clock = mockClock()
+	logger.Start()
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RemoteAddr = "203.0.113.1:5150"
+	r.RequestURI = "/"
+	r.Proto = "HTTP/1.1"
+
+	logger.ServeHTTP(discardWriter{}, r)
+	logger.Stop(context.Background())
+
+	actual := readDatagram(t, conn)
+	expected := fmt.Sprintf(`<28>Jun  3 16:45:22 host test[%d]: 203.0.113.1 - - [03/Jun/2014:16:45:22 +0000] "GET / HTTP/1.1" 404 19`, os.Getpid())
+	if actual != expected {
+		t.Errorf("Message was %q, but expected %q", actual, expected)
+	}
+}
+
+// readFrame reads an octet-counted syslog message.
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	s, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSyslogTCPReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	w := dialTestSyslog(t, SyslogConfig{
+		Network: "tcp",
+		Addr:    l.Addr().String(),
+		Format:  RFC5424,
+	})
+	defer w.Close()
+
+	first := <-conns
+	if err := w.WriteLine([]byte("one\n"), 200); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf("<134>1 2014-06-03T16:45:22.036000Z host test %d - - one", os.Getpid())
+	if actual := readFrame(t, bufio.NewReader(first)); actual != expected {
+		t.Errorf("Message was %q, but expected %q", actual, expected)
+	}
+
+	// The daemon goes away, and the writer eventually notices.
+	first.Close()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		_ = w.WriteLine([]byte("two\n"), 200)
+
+		select {
+		case second := <-conns:
+			defer second.Close()
+
+			expected := fmt.Sprintf("<134>1 2014-06-03T16:45:23.043000Z host test %d - - two", os.Getpid())
+			if actual := readFrame(t, bufio.NewReader(second)); actual != expected {
+				t.Errorf("Message was %q, but expected %q", actual, expected)
+			}
+			return
+		case <-timeout:
+			t.Fatal("Never reconnected")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestSyslogWriteTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conns := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	w := dialTestSyslog(t, SyslogConfig{
+		Network:      "tcp",
+		Addr:         l.Addr().String(),
+		Format:       RFC5424,
+		WriteTimeout: 50 * time.Millisecond,
+	})
+	defer w.Close()
+
+	first := <-conns
+	defer first.Close()
+
+	// The daemon hangs, and never reads another byte.
+	hung, peer := net.Pipe()
+	defer peer.Close()
+	w.conn.Close()
+	w.conn = hung
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.WriteLine([]byte("one\n"), 200)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write never timed out")
+	}
+
+	second := <-conns
+	defer second.Close()
+
+	expected := fmt.Sprintf("<134>1 2014-06-03T16:45:22.036000Z host test %d - - one", os.Getpid())
+	if actual := readFrame(t, bufio.NewReader(second)); actual != expected {
+		t.Errorf("Message was %q, but expected %q", actual, expected)
+	}
+}
@@ -0,0 +1,222 @@
+package logging
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Tail keeps the most recent entries logged by one or more LoggingHandlers in
+// memory, and serves them, followed by new entries as they're logged, as a
+// stream of Server-Sent Events. Each event's data is an entry formatted as
+// JSON.
+//
+// Requests may filter the entries they're sent with the following query
+// parameters:
+//
+//	status        a status code, or an inclusive range such as 500-599
+//	path          a prefix of the request URI
+//	method        the request method
+//	min_duration  the minimum time taken, such as 250ms
+//
+// For example, /debug/logs?status=500-599&path=/api/ streams server errors
+// from the API.
+type Tail struct {
+	m       sync.Mutex
+	ring    []*Entry
+	next    int
+	id      int64
+	clients map[chan tailEvent]struct{}
+}
+
+type tailEvent struct {
+	id int64
+	e  *Entry
+}
+
+// NewTail returns a Tail which keeps the last n entries.
+func NewTail(n int) *Tail {
+	return &Tail{
+		ring:    make([]*Entry, 0, n),
+		clients: make(map[chan tailEvent]struct{}),
+	}
+}
+
+// WithTail returns an Option which adds every entry logged to the given Tail.
+func WithTail(t *Tail) Option {
+	return func(al *LoggingHandler) {
+		al.tail = t
+	}
+}
+
+// add records a copy of the given entry and sends it to the Tail's clients.
+// Slow clients miss entries rather than hold up requests.
+func (t *Tail) add(e *Entry) {
+	c := *e
+	c.Request = nil
+	c.ResponseHeader = nil
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if cap(t.ring) > 0 {
+		if len(t.ring) < cap(t.ring) {
+			t.ring = append(t.ring, &c)
+		} else {
+			t.ring[t.next] = &c
+		}
+		t.next = (t.next + 1) % cap(t.ring)
+	}
+	t.id++
+
+	for ch := range t.clients {
+		select {
+		case ch <- tailEvent{id: t.id, e: &c}:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel of new entries and the entries already recorded,
+// oldest first.
+func (t *Tail) subscribe() (chan tailEvent, []tailEvent) {
+	ch := make(chan tailEvent, 64)
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.clients[ch] = struct{}{}
+
+	recent := make([]tailEvent, 0, len(t.ring))
+	start := 0
+	if len(t.ring) == cap(t.ring) {
+		start = t.next
+	}
+	for i := 0; i < len(t.ring); i++ {
+		recent = append(recent, tailEvent{
+			id: t.id - int64(len(t.ring)-1-i),
+			e:  t.ring[(start+i)%len(t.ring)],
+		})
+	}
+	return ch, recent
+}
+
+func (t *Tail) unsubscribe(ch chan tailEvent) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	delete(t.clients, ch)
+}
+
+func (t *Tail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming Unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	f, err := parseTailFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ch, recent := t.subscribe()
+	defer t.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	var b []byte
+	send := func(event tailEvent) error {
+		if !f.matches(event.e) {
+			return nil
+		}
+
+		b = append(b[:0], "id: "...)
+		b = strconv.AppendInt(b, event.id, 10)
+		b = append(b, "\ndata: "...)
+		b = JSON.Format(b, event.e)
+		b = append(b, '\n') // JSON lines end in one newline; events in two
+		_, err := w.Write(b)
+		return err
+	}
+
+	for _, event := range recent {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case event := <-ch:
+			if err := send(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+type tailFilter struct {
+	minStatus, maxStatus int
+	path                 string
+	method               string
+	minDuration          time.Duration
+}
+
+func parseTailFilter(r *http.Request) (tailFilter, error) {
+	q := r.URL.Query()
+	f := tailFilter{
+		path:   q.Get("path"),
+		method: q.Get("method"),
+	}
+
+	if s := q.Get("status"); s != "" {
+		min, max := s, s
+		if i := strings.IndexByte(s, '-'); i != -1 {
+			min, max = s[:i], s[i+1:]
+		}
+
+		var err1, err2 error
+		f.minStatus, err1 = strconv.Atoi(min)
+		f.maxStatus, err2 = strconv.Atoi(max)
+		if err1 != nil || err2 != nil {
+			return f, fmt.Errorf("invalid status: %q", s)
+		}
+	}
+
+	if s := q.Get("min_duration"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return f, fmt.Errorf("invalid min_duration: %q", s)
+		}
+		f.minDuration = d
+	}
+
+	return f, nil
+}
+
+func (f tailFilter) matches(e *Entry) bool {
+	if f.minStatus != 0 && (e.Status < f.minStatus || e.Status > f.maxStatus) {
+		return false
+	}
+
+	if f.method != "" && e.Method != f.method {
+		return false
+	}
+
+	if !strings.HasPrefix(e.RequestURI, f.path) {
+		return false
+	}
+
+	return e.Duration >= f.minDuration
+}
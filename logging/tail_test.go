@@ -0,0 +1,177 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tailEntry(uri string, status int) *Entry {
+	e := testEntry()
+	e.RequestURI = uri
+	e.Status = status
+	e.TimeToFirstByte = 0
+	e.UserAgent = ""
+	return e
+}
+
+// readEvent reads the data of the next Server-Sent Event.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	var id, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimSpace(line[4:])
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimSpace(line[6:])
+		case line == "\n":
+			return id + " " + data
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	tail := NewTail(2)
+	tail.add(tailEntry("/a", 500))
+	tail.add(tailEntry("/b", 200))
+	tail.add(tailEntry("/c", 503))
+
+	server := httptest.NewServer(tail)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", server.URL+"?status=500-599", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if v := resp.Header.Get("Content-Type"); v != "text/event-stream" {
+		t.Errorf("Content-Type was %q", v)
+	}
+
+	r := bufio.NewReader(resp.Body)
+
+	// /a has fallen out of the ring, and /b doesn't match.
+	expected := `3 {"time":"2014-06-03T16:45:22.036Z","remote_addr":"203.0.113.1","method":"GET","uri":"/c","proto":"HTTP/1.1","status":503,"size":13,"duration_ms":1007.000,"request_id":"req12345"}`
+	if actual := readEvent(t, r); actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+
+	// The client is subscribed before the backlog is sent, so this will be
+	// streamed.
+	tail.add(tailEntry("/d", 200))
+	tail.add(tailEntry("/e", 500))
+
+	expected = `5 {"time":"2014-06-03T16:45:22.036Z","remote_addr":"203.0.113.1","method":"GET","uri":"/e","proto":"HTTP/1.1","status":500,"size":13,"duration_ms":1007.000,"request_id":"req12345"}`
+	if actual := readEvent(t, r); actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+}
+
+func TestTailWithoutHistory(t *testing.T) {
+	tail := NewTail(0)
+	tail.add(tailEntry("/a", 200))
+
+	server := httptest.NewServer(tail)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The headers are only sent once the client is subscribed.
+	tail.add(tailEntry("/b", 200))
+
+	expected := `2 {"time":"2014-06-03T16:45:22.036Z","remote_addr":"203.0.113.1","method":"GET","uri":"/b","proto":"HTTP/1.1","status":200,"size":13,"duration_ms":1007.000,"request_id":"req12345"}`
+	if actual := readEvent(t, bufio.NewReader(resp.Body)); actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+}
+
+func TestTailFilter(t *testing.T) {
+	e := tailEntry("/api/users", 404)
+	e.Method = "POST"
+
+	tests := map[string]bool{
+		"":                                       true,
+		"?status=404":                            true,
+		"?status=500-599":                        false,
+		"?path=/api/":                            true,
+		"?path=/static/":                         false,
+		"?method=POST":                           true,
+		"?method=GET":                            false,
+		"?min_duration=1s":                       true,
+		"?min_duration=1.5s":                     false,
+		"?status=400-499&path=/api/&method=POST": true,
+	}
+
+	for query, expected := range tests {
+		r := httptest.NewRequest("GET", "/debug/logs"+query, nil)
+		f, err := parseTailFilter(r)
+		if err != nil {
+			t.Errorf("%q: %s", query, err)
+			continue
+		}
+
+		if v := f.matches(e); v != expected {
+			t.Errorf("%q matching was %v, but expected %v", query, v, expected)
+		}
+	}
+
+	for _, query := range []string{"?status=bad", "?status=400-", "?min_duration=soon"} {
+		r := httptest.NewRequest("GET", "/debug/logs"+query, nil)
+		if _, err := parseTailFilter(r); err == nil {
+			t.Errorf("%q should not have parsed", query)
+		}
+	}
+}
+
+func TestLoggingHandlerTail(t *testing.T) {
+	tail := NewTail(10)
+	logger := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		discardWriter{},
+		WithTail(tail),
+	)
+	logger.Start()
+	defer logger.Stop(context.Background())
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RequestURI = "/"
+	logger.ServeHTTP(discardWriter{}, r)
+
+	_, recent := tail.subscribe()
+	if len(recent) != 1 || recent[0].e.RequestURI != "/" || recent[0].e.Request != nil {
+		t.Errorf("Recent entries were %+v", recent)
+	}
+}
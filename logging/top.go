@@ -0,0 +1,286 @@
+package logging
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Top summarizes the entries logged by one or more LoggingHandlers over a
+// sliding window: the most common paths, client IPs, and user agents, and the
+// number of responses with each status. It serves the summary as plain text,
+// e.g. from /debug/top, listing the top 10 of each unless the request has an n
+// query parameter.
+//
+// Memory use is bounded no matter how many distinct values there are: each
+// list is tracked by a Space-Saving sketch of fixed capacity, which may
+// overestimate the counts of values near the bottom of the list, but never
+// misses a value which accounts for more than 1/capacity of the requests.
+//
+// Entries which were sampled count for as many requests as they stand for, so
+// with sampling the counts are estimates.
+type Top struct {
+	clock    clock
+	window   time.Duration
+	width    time.Duration
+	capacity int
+
+	m       sync.Mutex
+	buckets []*topBucket // oldest first
+}
+
+// The window is divided into this many buckets, which expire one at a time.
+const topBuckets = 10
+
+type topBucket struct {
+	start    time.Time
+	total    int64
+	paths    *sketch
+	ips      *sketch
+	agents   *sketch
+	statuses map[int]int64
+}
+
+// NewTop returns a Top which summarizes the given window of time, tracking up
+// to capacity distinct paths, client IPs, and user agents.
+func NewTop(window time.Duration, capacity int) *Top {
+	return &Top{
+		clock:    time.Now,
+		window:   window,
+		width:    window / topBuckets,
+		capacity: capacity,
+	}
+}
+
+// WithTop returns an Option which adds every entry logged to the given Top.
+func WithTop(t *Top) Option {
+	return func(al *LoggingHandler) {
+		al.top = t
+	}
+}
+
+func (t *Top) add(e *Entry) {
+	path := e.RequestURI
+	if i := strings.IndexByte(path, '?'); i != -1 {
+		path = path[:i]
+	}
+
+	// A sampled entry stands in for the requests which weren't logged.
+	n := int64(1)
+	if e.SampleRate > 0 {
+		n = int64(math.Round(1 / e.SampleRate))
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	b := t.current()
+	b.total += n
+	b.paths.add(path, n)
+	b.ips.add(e.RemoteAddr, n)
+	b.agents.add(e.UserAgent, n)
+	b.statuses[e.Status] += n
+}
+
+// current returns the bucket for the current time, expiring old buckets.
+func (t *Top) current() *topBucket {
+	now := t.clock().Truncate(t.width)
+	t.expire(now)
+
+	if n := len(t.buckets); n > 0 && t.buckets[n-1].start.Equal(now) {
+		return t.buckets[n-1]
+	}
+
+	b := &topBucket{
+		start:    now,
+		paths:    newSketch(t.capacity),
+		ips:      newSketch(t.capacity),
+		agents:   newSketch(t.capacity),
+		statuses: make(map[int]int64),
+	}
+	t.buckets = append(t.buckets, b)
+	return b
+}
+
+// expire drops the buckets which started a window or more before the bucket
+// starting at the given time.
+func (t *Top) expire(now time.Time) {
+	i := 0
+	for i < len(t.buckets) && now.Sub(t.buckets[i].start) >= t.window {
+		i++
+	}
+	t.buckets = t.buckets[i:]
+}
+
+// A topCount is a value and the number of times it was seen.
+type topCount struct {
+	value string
+	count int64
+}
+
+type topSummary struct {
+	total    int64
+	paths    []topCount
+	ips      []topCount
+	agents   []topCount
+	statuses []topCount
+}
+
+// summary returns the top n of each list over the current window.
+func (t *Top) summary(n int) topSummary {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.expire(t.clock().Truncate(t.width))
+
+	var (
+		s                            topSummary
+		paths, ips, agents, statuses = map[string]int64{}, map[string]int64{}, map[string]int64{}, map[string]int64{}
+	)
+	for _, b := range t.buckets {
+		s.total += b.total
+		b.paths.sumInto(paths)
+		b.ips.sumInto(ips)
+		b.agents.sumInto(agents)
+		for status, count := range b.statuses {
+			statuses[strconv.Itoa(status)] += count
+		}
+	}
+
+	s.paths = topN(paths, n)
+	s.ips = topN(ips, n)
+	s.agents = topN(agents, n)
+	s.statuses = topN(statuses, len(statuses))
+	return s
+}
+
+// topN returns the n values with the highest counts, highest first.
+func topN(counts map[string]int64, n int) []topCount {
+	top := make([]topCount, 0, len(counts))
+	for v, c := range counts {
+		top = append(top, topCount{value: v, count: c})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].count != top[j].count {
+			return top[i].count > top[j].count
+		}
+		return top[i].value < top[j].value
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+func (t *Top) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := 10
+	if s := r.URL.Query().Get("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 {
+			http.Error(w, fmt.Sprintf("invalid n: %q", s), http.StatusBadRequest)
+			return
+		}
+		n = v
+	}
+
+	s := t.summary(n)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%d requests in the last %s\n", s.total, t.window)
+	writeTopCounts(w, "Paths", s.paths)
+	writeTopCounts(w, "Client IPs", s.ips)
+	writeTopCounts(w, "User agents", s.agents)
+	writeTopCounts(w, "Statuses", s.statuses)
+}
+
+func writeTopCounts(w http.ResponseWriter, title string, counts []topCount) {
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, c := range counts {
+		fmt.Fprintf(w, "%10d  %s\n", c.count, appendLogfmtValue(nil, orDash(c.value)))
+	}
+}
+
+// A sketch is a Space-Saving sketch, which counts the most frequent of an
+// unbounded number of values in bounded memory. When it's full, a new value
+// replaces the least frequent one and inherits its count.
+type sketch struct {
+	capacity int
+	index    map[string]*sketchCounter
+	heap     sketchHeap // least frequent first
+}
+
+type sketchCounter struct {
+	value string
+	count int64
+	i     int // index in the heap
+}
+
+func newSketch(capacity int) *sketch {
+	return &sketch{
+		capacity: capacity,
+		index:    make(map[string]*sketchCounter, capacity),
+	}
+}
+
+// add adds n to the count of the given value.
+func (s *sketch) add(value string, n int64) {
+	if c, ok := s.index[value]; ok {
+		c.count += n
+		heap.Fix(&s.heap, c.i)
+		return
+	}
+
+	if len(s.heap) < s.capacity {
+		c := &sketchCounter{value: value, count: n}
+		s.index[value] = c
+		heap.Push(&s.heap, c)
+		return
+	}
+
+	if s.capacity == 0 {
+		return
+	}
+
+	c := s.heap[0]
+	delete(s.index, c.value)
+	c.value = value
+	c.count += n
+	s.index[value] = c
+	heap.Fix(&s.heap, 0)
+}
+
+func (s *sketch) sumInto(counts map[string]int64) {
+	for _, c := range s.heap {
+		counts[c.value] += c.count
+	}
+}
+
+type sketchHeap []*sketchCounter
+
+func (h sketchHeap) Len() int           { return len(h) }
+func (h sketchHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h sketchHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].i = i
+	h[j].i = j
+}
+
+func (h *sketchHeap) Push(x interface{}) {
+	c := x.(*sketchCounter)
+	c.i = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *sketchHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
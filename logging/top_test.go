@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSketch(t *testing.T) {
+	s := newSketch(10)
+	for i := 0; i < 10000; i++ {
+		switch {
+		case i%4 == 0:
+			s.add("/heavy", 1)
+		case i%10 == 1:
+			s.add("/medium", 1)
+		default:
+			s.add(fmt.Sprintf("/unique/%d", i), 1)
+		}
+	}
+
+	counts := map[string]int64{}
+	s.sumInto(counts)
+
+	if len(counts) != 10 {
+		t.Errorf("Sketch had %d values, but expected 10", len(counts))
+	}
+
+	top := topN(counts, 2)
+	if top[0].value != "/heavy" || top[0].count < 2500 {
+		t.Errorf("Top value was %+v, but expected /heavy with at least 2500", top[0])
+	}
+
+	if top[1].value != "/medium" || top[1].count < 1000 {
+		t.Errorf("Second value was %+v, but expected /medium with at least 1000", top[1])
+	}
+}
+
+func TestTopWindow(t *testing.T) {
+	now := time.Date(2014, 6, 3, 16, 45, 0, 0, time.UTC)
+	top := NewTop(time.Minute, 100)
+	top.clock = func() time.Time { return now }
+
+	top.add(tailEntry("/old", 200))
+
+	now = now.Add(30 * time.Second)
+	top.add(tailEntry("/new?q=1", 500))
+	top.add(tailEntry("/new?q=2", 200))
+
+	if s := top.summary(10); s.total != 3 || s.paths[0] != (topCount{"/new", 2}) {
+		t.Errorf("Summary was %+v", s)
+	}
+
+	// The first bucket expires a minute after it started.
+	now = now.Add(30 * time.Second)
+	if s := top.summary(10); s.total != 2 || len(s.paths) != 1 {
+		t.Errorf("Summary was %+v", s)
+	}
+
+	now = now.Add(time.Hour)
+	if s := top.summary(10); s.total != 0 || len(s.paths) != 0 {
+		t.Errorf("Summary was %+v", s)
+	}
+}
+
+func TestTopSampled(t *testing.T) {
+	top := NewTop(time.Minute, 100)
+
+	// One logged request in a hundred, but every error.
+	ok := tailEntry("/a", 200)
+	ok.SampleRate = 0.01
+	top.add(ok)
+	top.add(tailEntry("/a", 500))
+
+	s := top.summary(10)
+	if s.total != 101 || s.paths[0] != (topCount{"/a", 101}) {
+		t.Errorf("Summary was %+v", s)
+	}
+
+	expected := []topCount{{"200", 100}, {"500", 1}}
+	if !reflect.DeepEqual(s.statuses, expected) {
+		t.Errorf("Statuses were %v, but expected %v", s.statuses, expected)
+	}
+}
+
+func TestTopServeHTTP(t *testing.T) {
+	top := NewTop(time.Minute, 100)
+	for i := 0; i < 3; i++ {
+		top.add(tailEntry("/a", 200))
+	}
+	e := tailEntry("/b", 404)
+	e.RemoteAddr = "198.51.100.7"
+	e.UserAgent = "curl/7.0 (x86_64)"
+	top.add(e)
+
+	w := httptest.NewRecorder()
+	top.ServeHTTP(w, httptest.NewRequest("GET", "/debug/top?n=1", nil))
+
+	b, err := ioutil.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := string(b)
+	expected := `4 requests in the last 1m0s
+
+Paths:
+         3  /a
+
+Client IPs:
+         3  203.0.113.1
+
+User agents:
+         3  -
+
+Statuses:
+         3  200
+         1  404
+`
+	if actual != expected {
+		t.Errorf("Was \n`%s`\n, but expected \n`%s`", actual, expected)
+	}
+
+	w = httptest.NewRecorder()
+	top.ServeHTTP(w, httptest.NewRequest("GET", "/debug/top?n=none", nil))
+	if w.Code != 400 {
+		t.Errorf("Status was %d, but expected 400", w.Code)
+	}
+}
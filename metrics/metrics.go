@@ -4,9 +4,14 @@
 package metrics
 
 import (
+	"context"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/codahale/http-handlers/internal/response"
 	"github.com/codahale/metrics"
 )
 
@@ -23,25 +28,364 @@ import (
 // By tracking incoming requests and outgoing responses, one can monitor not
 // only the requests per second, but also the number of requests being processed
 // at any given point in time.
-func Wrap(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requests.Add()                  // inc requests
-		defer responses.Add()           // inc responses when we're done
-		defer recordLatency(time.Now()) // record latency when we're done
+//
+// Responses are also counted by status code, status class and request method,
+// and, for requests with routes, by route:
+//
+//     HTTP.Responses.{100,...,599}
+//     HTTP.Responses.{1xx,2xx,3xx,4xx,5xx}
+//     HTTP.Methods.{GET,POST,...,OTHER}.Responses
+//     HTTP.Routes.{route}.Responses
+//     HTTP.Routes.{route}.Responses.{1xx,2xx,3xx,4xx,5xx}
+//     HTTP.Routes.{route}.Latency.{P50,P75,P90,P95,P99,P999}
+//
+// A request's route is the name given to it by SetRoute, or else by the
+// function passed to WithRouteFunc. Connections which are hijacked without
+// writing a status are counted as 101 Switching Protocols.
+//
+// The sizes of request bodies, as read by the handler or as declared by their
+// Content-Length if that's larger, and of response bodies, in bytes, are
+// recorded over the same window:
+//
+//     HTTP.RequestSize.{P50,P75,P90,P95,P99,P999}
+//     HTTP.ResponseSize.{P50,P75,P90,P95,P99,P999}
+//     HTTP.Routes.{route}.RequestSize.{P50,P75,P90,P95,P99,P999}
+//     HTTP.Routes.{route}.ResponseSize.{P50,P75,P90,P95,P99,P999}
+//
+// The proportion of responses which were server errors over the same
+// five-minute window as the latency, in thousandths, is published as:
+//
+//     HTTP.ErrorRatio
+//
+// A request whose handler panics is counted as a 500 Internal Server Error, and
+// the panic is passed on, e.g. to a recovery handler.
+//
+// Wrap is equivalent to New("HTTP", opts...).Wrap(h). To keep the metrics of
+// several handlers apart, use a Recorder with a different prefix for each.
+func Wrap(h http.Handler, opts ...Option) http.Handler {
+	return New(defaultPrefix, opts...).Wrap(h)
+}
 
-		h.ServeHTTP(w, r)
-	})
+const defaultPrefix = "HTTP"
+
+// A Recorder records the metrics described by Wrap for the handlers it wraps,
+// with the given prefix in place of HTTP, so that e.g. a public and an admin
+// server in the same process can be told apart:
+//
+//     public := metrics.New("HTTP.Public")
+//     admin := metrics.New("HTTP.Admin")
+//
+// Recorders with the same prefix share metrics.
+type Recorder struct {
+	prefix    string
+	routeFunc func(r *http.Request) string
+	maxRoutes int
+
+	requests  metrics.Counter
+	responses metrics.Counter
+	latency   *metrics.Histogram
+	reqSize   *metrics.Histogram
+	respSize  *metrics.Histogram
+	classes   [6]metrics.Counter
+	codes     [600]metrics.Counter
+	methods   map[string]metrics.Counter
+	errors    *errorWindow
+
+	m      sync.RWMutex
+	routes map[string]*routeMetrics
 }
 
+// New returns a Recorder whose metrics are named with the given prefix.
+func New(prefix string, opts ...Option) *Recorder {
+	rec := &Recorder{
+		prefix:    prefix,
+		maxRoutes: 100,
+		requests:  metrics.Counter(prefix + ".Requests"),
+		responses: metrics.Counter(prefix + ".Responses"),
+		latency:   latencyHistogram(prefix + ".Latency"),
+		reqSize:   sizeHistogram(prefix + ".RequestSize"),
+		respSize:  sizeHistogram(prefix + ".ResponseSize"),
+		errors:    errorRatio(prefix + ".ErrorRatio"),
+		methods:   make(map[string]metrics.Counter, len(methodNames)),
+		routes:    make(map[string]*routeMetrics),
+	}
+	for i, name := range classNames {
+		rec.classes[i] = metrics.Counter(prefix + ".Responses." + name)
+	}
+	for code := 100; code < len(rec.codes); code++ {
+		rec.codes[code] = metrics.Counter(prefix + ".Responses." + strconv.Itoa(code))
+	}
+	for _, method := range methodNames {
+		rec.methods[method] = metrics.Counter(prefix + ".Methods." + method + ".Responses")
+	}
+	for _, opt := range opts {
+		opt(rec)
+	}
+	return rec
+}
+
+// Wrap returns a handler which records metrics for the given handler.
+func (rec *Recorder) Wrap(h http.Handler) http.Handler {
+	return &handler{handler: h, rec: rec}
+}
+
+// An Option configures the metrics recorded by a Recorder.
+type Option func(*Recorder)
+
+// WithRouteFunc returns an Option which names the route of each request with
+// the given function, e.g. by matching it against a router's patterns. The
+// function should return a name from a small, fixed set, such as
+// "GET /users/:id", rather than anything derived from the path itself, and may
+// return an empty string for requests with no route.
+func WithRouteFunc(f func(r *http.Request) string) Option {
+	return func(rec *Recorder) {
+		rec.routeFunc = f
+	}
+}
+
+// WithMaxRoutes returns an Option which records metrics for at most n distinct
+// routes, rather than the default of 100. Requests for routes beyond the first
+// n are recorded under the route "_other", so that a buggy route function
+// can't create an unbounded number of metrics.
+//
+// Each route's latency and size histograms take about 600KB between them, so
+// the default allows for roughly 60MB of route metrics.
+func WithMaxRoutes(n int) Option {
+	return func(rec *Recorder) {
+		rec.maxRoutes = n
+	}
+}
+
+// SetRoute names the route of the request with the given context, overriding
+// the route function, if any. It has no effect if the request isn't being
+// handled by a handler returned by Wrap.
+func SetRoute(ctx context.Context, route string) {
+	if info, ok := ctx.Value(routeKey).(*routeInfo); ok {
+		info.m.Lock()
+		info.route = route
+		info.m.Unlock()
+	}
+}
+
+type handler struct {
+	handler http.Handler
+	rec     *Recorder
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.rec.requests.Add() // inc requests
+
+	info := &routeInfo{}
+	if h.rec.routeFunc != nil {
+		info.route = h.rec.routeFunc(r)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), routeKey, info))
+
+	var body *countingBody
+	if r.Body != nil && r.Body != http.NoBody {
+		body = &countingBody{ReadCloser: r.Body}
+		r.Body = body
+	}
+
+	sr := response.NewRecorder(w)
+	start := time.Now()
+	defer func() { // record when we're done
+		status := sr.Status()
+		// a panicking handler never finishes its response, so count it as
+		// the 500 a recovery handler further up will send instead
+		err := recover()
+		if err != nil {
+			status = http.StatusInternalServerError
+		}
+
+		h.rec.record(start, r, body, status, sr.Size(), info)
+
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	h.handler.ServeHTTP(&sr, r)
+}
+
+func (rec *Recorder) record(start time.Time, r *http.Request, body *countingBody, status int, size int64, info *routeInfo) {
+	elapsedMS := int64(time.Now().Sub(start).Seconds() * 1000.0)
+	class := statusClass(status)
+
+	var reqSize int64
+	if body != nil {
+		reqSize = body.n
+	}
+	if r.ContentLength > reqSize {
+		reqSize = r.ContentLength
+	}
+	reqSize = clampSize(reqSize)
+	respSize := clampSize(size)
+
+	rec.responses.Add()
+	_ = rec.latency.RecordValue(elapsedMS)
+	_ = rec.reqSize.RecordValue(reqSize)
+	_ = rec.respSize.RecordValue(respSize)
+	rec.classes[class].Add()
+	if class != 0 {
+		rec.codes[status].Add()
+	}
+	rec.errors.add(class == 5)
+	rec.methodResponses(r.Method).Add()
+
+	if route := info.Route(); route != "" {
+		rm := rec.route(route)
+		rm.responses.Add()
+		rm.classes[class].Add()
+		_ = rm.latency.RecordValue(elapsedMS)
+		_ = rm.reqSize.RecordValue(reqSize)
+		_ = rm.respSize.RecordValue(respSize)
+	}
+}
+
+// methodResponses returns the response counter for the given method, lumping
+// non-standard methods together.
+func (rec *Recorder) methodResponses(method string) metrics.Counter {
+	if c, ok := rec.methods[method]; ok {
+		return c
+	}
+	return rec.methods["OTHER"]
+}
+
+// route returns the metrics for the given route, creating them if need be.
+func (rec *Recorder) route(name string) *routeMetrics {
+	rec.m.RLock()
+	rm, ok := rec.routes[name]
+	if !ok && len(rec.routes) >= rec.maxRoutes {
+		// over the cap, so don't contend for the write lock
+		rm, ok = rec.routes[otherRoute]
+	}
+	rec.m.RUnlock()
+	if ok {
+		return rm
+	}
+
+	rec.m.Lock()
+	defer rec.m.Unlock()
+
+	if rm, ok := rec.routes[name]; ok {
+		return rm
+	}
+
+	if len(rec.routes) >= rec.maxRoutes {
+		name = otherRoute
+		if rm, ok := rec.routes[name]; ok {
+			return rm
+		}
+	}
+
+	rm = newRouteMetrics(rec.prefix + ".Routes." + name)
+	rec.routes[name] = rm
+	return rm
+}
+
+const otherRoute = "_other"
+
+type routeMetrics struct {
+	responses metrics.Counter
+	classes   [6]metrics.Counter
+	latency   *metrics.Histogram
+	reqSize   *metrics.Histogram
+	respSize  *metrics.Histogram
+}
+
+func newRouteMetrics(prefix string) *routeMetrics {
+	rm := &routeMetrics{
+		responses: metrics.Counter(prefix + ".Responses"),
+		latency:   latencyHistogram(prefix + ".Latency"),
+		reqSize:   sizeHistogram(prefix + ".RequestSize"),
+		respSize:  sizeHistogram(prefix + ".ResponseSize"),
+	}
+	for i, name := range classNames {
+		rm.classes[i] = metrics.Counter(prefix + ".Responses." + name)
+	}
+	return rm
+}
+
+// countingBody counts the bytes of a request body read by the handler.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+type routeInfo struct {
+	m     sync.Mutex
+	route string
+}
+
+func (info *routeInfo) Route() string {
+	info.m.Lock()
+	defer info.m.Unlock()
+	return info.route
+}
+
+type contextKey int
+
+const routeKey contextKey = 0
+
 var (
-	requests  = metrics.Counter("HTTP.Requests")
-	responses = metrics.Counter("HTTP.Responses")
+	classNames  = [6]string{"other", "1xx", "2xx", "3xx", "4xx", "5xx"}
+	methodNames = []string{
+		"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE", "OTHER",
+	}
+)
+
+// statusClass returns the index of the status's class in classNames.
+func statusClass(status int) int {
+	if status < 100 || status > 599 {
+		return 0
+	}
+	return status / 100
+}
 
-	// a five-minute window tracking 1ms-3min
-	latency = metrics.NewHistogram("HTTP.Latency", 1, 1000*60*3, 3)
+var (
+	hm         sync.Mutex
+	histograms = make(map[string]*metrics.Histogram)
 )
 
-func recordLatency(start time.Time) {
-	elapsedMS := time.Now().Sub(start).Seconds() * 1000.0
-	_ = latency.RecordValue(int64(elapsedMS))
+// latencyHistogram returns a histogram tracking 1ms-3min.
+func latencyHistogram(name string) *metrics.Histogram {
+	return histogram(name, 1000*60*3, 3)
+}
+
+// maxSize is the largest size recorded; larger bodies are recorded as this.
+const maxSize = 1 << 30
+
+// sizeHistogram returns a histogram tracking 0-1GiB. Sizes don't need the
+// precision of latencies, and two significant figures keep it small.
+func sizeHistogram(name string) *metrics.Histogram {
+	return histogram(name, maxSize, 2)
+}
+
+func clampSize(n int64) int64 {
+	if n > maxSize {
+		return maxSize
+	}
+	return n
+}
+
+// histogram returns the histogram with the given name, creating it if need be,
+// since registering a histogram twice panics. All histograms cover a
+// five-minute window.
+func histogram(name string, maxValue int64, sigfigs int) *metrics.Histogram {
+	hm.Lock()
+	defer hm.Unlock()
+
+	h, ok := histograms[name]
+	if !ok {
+		h = metrics.NewHistogram(name, 1, maxValue, sigfigs)
+		histograms[name] = h
+	}
+	return h
 }
@@ -5,9 +5,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/codahale/http-handlers/recovery"
 	"github.com/codahale/metrics"
 )
 
@@ -71,16 +73,230 @@ func TestMetrics(t *testing.T) {
 
 func BenchmarkMetrics(b *testing.B) {
 	var (
-		r *http.Request
-		w http.ResponseWriter
+		r = httptest.NewRequest("GET", "/", nil)
 		h = Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	)
 	b.ReportAllocs()
 	b.ResetTimer()
 
 	b.RunParallel(func(pb *testing.PB) {
+		w := httptest.NewRecorder()
 		for pb.Next() {
 			h.ServeHTTP(w, r)
 		}
 	})
 }
+
+func TestRoutes(t *testing.T) {
+	h := Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/users/1":
+				SetRoute(r.Context(), "users")
+			case "/missing":
+				http.NotFound(w, r)
+			case "/error":
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}),
+		WithRouteFunc(func(r *http.Request) string {
+			return "routes" + r.URL.Path
+		}),
+		WithMaxRoutes(3),
+	)
+
+	before, _ := metrics.Snapshot()
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/users/1"},
+		{"GET", "/missing"},
+		{"POST", "/error"},
+		{"BREW", "/a"},
+		{"GET", "/b"},
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	after, gauges := metrics.Snapshot()
+
+	expectedCounters := map[string]uint64{
+		"HTTP.Responses.2xx":                       3,
+		"HTTP.Responses.4xx":                       1,
+		"HTTP.Responses.5xx":                       1,
+		"HTTP.Responses.200":                       3,
+		"HTTP.Responses.404":                       1,
+		"HTTP.Responses.500":                       1,
+		"HTTP.Methods.GET.Responses":               3,
+		"HTTP.Methods.POST.Responses":              1,
+		"HTTP.Methods.OTHER.Responses":             1,
+		"HTTP.Routes.users.Responses":              1,
+		"HTTP.Routes.users.Responses.2xx":          1,
+		"HTTP.Routes.routes/missing.Responses.4xx": 1,
+		"HTTP.Routes.routes/error.Responses.5xx":   1,
+		"HTTP.Routes._other.Responses":             2,
+		"HTTP.Routes._other.Responses.2xx":         2,
+	}
+
+	for name, expected := range expectedCounters {
+		if v := after[name] - before[name]; v != expected {
+			t.Errorf("%s was %d, but expected %d", name, v, expected)
+		}
+	}
+
+	if _, ok := after["HTTP.Routes.routes/a.Responses"]; ok {
+		t.Error("Routes beyond the maximum should be lumped together")
+	}
+
+	if _, ok := gauges["HTTP.Routes.users.Latency.P99"]; !ok {
+		t.Error("Missing route latency gauge")
+	}
+
+	if v, ok := gauges["HTTP.ErrorRatio"]; !ok || v <= 0 {
+		t.Errorf("Error ratio was %d, but expected some errors", v)
+	}
+}
+
+func TestRoutesOverCap(t *testing.T) {
+	rec := New("OverCap", WithMaxRoutes(2))
+
+	rec.route("a")
+	rec.route("b")
+	other := rec.route("c")
+
+	for _, name := range []string{"d", "e", "c"} {
+		if rm := rec.route(name); rm != other {
+			t.Errorf("Route %q wasn't lumped into %s", name, otherRoute)
+		}
+	}
+
+	if n := len(rec.routes); n != 3 {
+		t.Errorf("Was tracking %d routes, but expected 3", n)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	h := recovery.Wrap(
+		New("Panic").Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("oh no")
+		})),
+		func(int64, interface{}, []string, *http.Request) {},
+	)
+
+	before, _ := metrics.Snapshot()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Status code was %d, but expected 500", w.Code)
+	}
+
+	after, gauges := metrics.Snapshot()
+
+	for name, expected := range map[string]uint64{
+		"Panic.Responses":     1,
+		"Panic.Responses.5xx": 1,
+		"Panic.Responses.500": 1,
+		"Panic.Responses.2xx": 0,
+	} {
+		if v := after[name] - before[name]; v != expected {
+			t.Errorf("%s was %d, but expected %d", name, v, expected)
+		}
+	}
+
+	if v := gauges["Panic.ErrorRatio"]; v != 1000 {
+		t.Errorf("Panic.ErrorRatio was %d, but expected 1000", v)
+	}
+}
+
+func TestNew(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	public := New("Test.Public").Wrap(ok)
+	admin := New("Test.Admin", WithRouteFunc(func(r *http.Request) string {
+		return "admin"
+	})).Wrap(ok)
+
+	before, _ := metrics.Snapshot()
+
+	public.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	public.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	admin.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	after, gauges := metrics.Snapshot()
+
+	expectedCounters := map[string]uint64{
+		"Test.Public.Requests":              2,
+		"Test.Public.Responses.2xx":         2,
+		"Test.Public.Methods.GET.Responses": 2,
+		"Test.Admin.Requests":               1,
+		"Test.Admin.Routes.admin.Responses": 1,
+		"HTTP.Requests":                     0,
+	}
+
+	for name, expected := range expectedCounters {
+		if v := after[name] - before[name]; v != expected {
+			t.Errorf("%s was %d, but expected %d", name, v, expected)
+		}
+	}
+
+	for _, name := range []string{"Test.Public.Latency.P50", "Test.Admin.Latency.P50"} {
+		if _, ok := gauges[name]; !ok {
+			t.Errorf("Missing gauge %q", name)
+		}
+	}
+}
+
+func TestSizes(t *testing.T) {
+	h := New("Test.Sizes", WithRouteFunc(func(r *http.Request) string {
+		return r.URL.Path[1:]
+	})).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload" {
+			_, _ = ioutil.ReadAll(r.Body)
+		}
+		_, _ = w.Write(make([]byte, 150))
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/upload", strings.NewReader(strings.Repeat("a", 100))))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/ignored", strings.NewReader(strings.Repeat("a", 200))))
+
+	_, gauges := metrics.Snapshot()
+
+	// sizes under 256 are recorded exactly at two significant figures
+	expectedGauges := map[string]int64{
+		"Test.Sizes.Routes.upload.RequestSize.P50":   100,
+		"Test.Sizes.Routes.upload.ResponseSize.P50":  150,
+		"Test.Sizes.Routes.ignored.RequestSize.P50":  200,
+		"Test.Sizes.Routes.ignored.ResponseSize.P50": 150,
+		"Test.Sizes.ResponseSize.P99":                150,
+	}
+
+	for name, expected := range expectedGauges {
+		if v, ok := gauges[name]; !ok || v != expected {
+			t.Errorf("%s was %d, but expected %d", name, v, expected)
+		}
+	}
+}
+
+type notifier struct {
+	*httptest.ResponseRecorder
+	closed chan bool
+}
+
+func (w notifier) CloseNotify() <-chan bool {
+	return w.closed
+}
+
+func TestCloseNotify(t *testing.T) {
+	w := notifier{httptest.NewRecorder(), make(chan bool)}
+
+	var ok bool
+	Wrap(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var n http.CloseNotifier
+		n, ok = rw.(http.CloseNotifier)
+		ok = ok && n.CloseNotify() == w.closed
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if !ok {
+		t.Error("CloseNotify wasn't passed through")
+	}
+}
@@ -0,0 +1,222 @@
+package metrics
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codahale/metrics"
+)
+
+// Prometheus returns a handler which renders every counter and gauge
+// registered with github.com/codahale/metrics, by this package or any other,
+// in the Prometheus text exposition format, or in the OpenMetrics format if the
+// request accepts it. It's typically mounted at /metrics.
+//
+// Metric names are sanitized by lowercasing them and replacing anything other
+// than letters and digits with underscores, and counters are given a _total
+// suffix, so HTTP.Requests becomes http_requests_total. The quantile gauges of
+// histograms, such as HTTP.Latency.P99, are grouped into summaries:
+//
+//	http_latency{quantile="0.99"} 42
+//
+// If several metrics have the same sanitized name, only the first, in order of
+// their original names, is rendered, and the number of metrics left out of the
+// most recent scrape is published as the Prometheus.Collisions gauge. Quantile gauges whose histogram's name is taken by
+// another metric are rendered as plain gauges.
+func Prometheus() http.Handler {
+	return http.HandlerFunc(servePrometheus)
+}
+
+const (
+	textContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// quantiles are the suffixes of the gauges which make up a histogram, and the
+// quantiles they represent.
+var quantiles = []struct {
+	suffix, quantile string
+}{
+	{".P50", "0.5"},
+	{".P75", "0.75"},
+	{".P90", "0.9"},
+	{".P95", "0.95"},
+	{".P99", "0.99"},
+	{".P999", "0.999"},
+}
+
+type family struct {
+	name    string // the original name
+	metric  string // the sanitized name
+	typ     string
+	counter uint64
+	gauge   int64
+	summary map[string]int64 // quantile to value
+}
+
+func servePrometheus(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", textContentType)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families() {
+		writeFamily(bw, f, openMetrics)
+	}
+	if openMetrics {
+		_, _ = bw.WriteString("# EOF\n")
+	}
+	_ = bw.Flush()
+}
+
+// families returns the current values of all metrics, sorted by name.
+func families() []*family {
+	counters, gauges := metrics.Snapshot()
+
+	byName := make(map[string]*family, len(counters)+len(gauges))
+	for name, v := range counters {
+		byName[name] = &family{name: name, typ: "counter", counter: v}
+	}
+
+	// Plain gauges first, so that they take precedence over summaries.
+	for name, v := range gauges {
+		if base, _ := splitQuantile(name); base == "" {
+			if _, ok := byName[name]; !ok {
+				byName[name] = &family{name: name, typ: "gauge", gauge: v}
+			}
+		}
+	}
+
+	for name, v := range gauges {
+		base, q := splitQuantile(name)
+		if base == "" {
+			continue
+		}
+
+		f, ok := byName[base]
+		if !ok {
+			f = &family{name: base, typ: "summary", summary: make(map[string]int64)}
+			byName[base] = f
+		} else if f.typ != "summary" {
+			// The name is taken, so it can't be a summary.
+			if _, ok := byName[name]; !ok {
+				byName[name] = &family{name: name, typ: "gauge", gauge: v}
+			}
+			continue
+		}
+		f.summary[q] = v
+	}
+
+	all := make([]*family, 0, len(byName))
+	for _, f := range byName {
+		f.metric = sanitize(f.name)
+		all = append(all, f)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].name < all[j].name
+	})
+
+	// Prometheus rejects a scrape with two families of the same name, and a
+	// counter's samples are named with a _total suffix.
+	taken := make(map[string]bool, len(all))
+	unique := all[:0]
+	var skipped int64
+	for _, f := range all {
+		names := []string{f.metric}
+		if f.typ == "counter" {
+			names = append(names, f.metric+"_total")
+		}
+
+		collides := false
+		for _, n := range names {
+			collides = collides || taken[n]
+		}
+		if collides {
+			skipped++
+			continue
+		}
+
+		for _, n := range names {
+			taken[n] = true
+		}
+		unique = append(unique, f)
+	}
+	collisions.Set(skipped)
+	return unique
+}
+
+var collisions = metrics.Gauge("Prometheus.Collisions")
+
+// splitQuantile returns the name of the histogram the given gauge belongs to
+// and the quantile it represents, or an empty string if it's not a quantile.
+func splitQuantile(name string) (string, string) {
+	for _, q := range quantiles {
+		if strings.HasSuffix(name, q.suffix) {
+			return strings.TrimSuffix(name, q.suffix), q.quantile
+		}
+	}
+	return "", ""
+}
+
+func writeFamily(w *bufio.Writer, f *family, openMetrics bool) {
+	name := f.metric
+	sample := name
+	if f.typ == "counter" {
+		sample += "_total"
+		if !openMetrics {
+			// The text format has no notion of families.
+			name = sample
+		}
+	}
+
+	_, _ = w.WriteString("# HELP " + name + " " + escapeHelp(f.name) + "\n")
+	_, _ = w.WriteString("# TYPE " + name + " " + f.typ + "\n")
+
+	switch f.typ {
+	case "counter":
+		_, _ = w.WriteString(sample + " " + strconv.FormatUint(f.counter, 10) + "\n")
+	case "gauge":
+		_, _ = w.WriteString(sample + " " + strconv.FormatInt(f.gauge, 10) + "\n")
+	case "summary":
+		for _, q := range quantiles {
+			if v, ok := f.summary[q.quantile]; ok {
+				_, _ = w.WriteString(sample + `{quantile="` + q.quantile + `"} ` + strconv.FormatInt(v, 10) + "\n")
+			}
+		}
+	}
+}
+
+// sanitize turns a metric name into a valid Prometheus metric name.
+func sanitize(name string) string {
+	b := make([]byte, 0, len(name)+1)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'A' && c <= 'Z':
+			b = append(b, c+'a'-'A')
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			b = append(b, c)
+		default:
+			// Collapse runs of punctuation.
+			if len(b) > 0 && b[len(b)-1] != '_' {
+				b = append(b, '_')
+			}
+		}
+	}
+
+	s := strings.TrimRight(string(b), "_")
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "_" + s
+	}
+	return s
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/codahale/metrics"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]string{
+		"HTTP.Requests":                        "http_requests",
+		"HTTP.Routes.GET /users/:id.Responses": "http_routes_get_users_id_responses",
+		"HTTP.Routes._other.Responses.5xx":     "http_routes_other_responses_5xx",
+		"5xx":                                  "_5xx",
+		"...":                                  "_",
+	}
+
+	for name, expected := range tests {
+		if actual := sanitize(name); actual != expected {
+			t.Errorf("%q was sanitized to %q, but expected %q", name, actual, expected)
+		}
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	metrics.Counter("Test.Prometheus.Count").AddN(3)
+	metrics.Gauge("Test.Prometheus.Gauge").Set(-2)
+	metrics.Gauge("Test.Prometheus.Latency.P50").Set(10)
+	metrics.Gauge("Test.Prometheus.Latency.P999").Set(100)
+
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	Prometheus().ServeHTTP(w, r)
+
+	if v := w.Header().Get("Content-Type"); v != textContentType {
+		t.Errorf("Content-Type was %q", v)
+	}
+
+	body := w.Body.String()
+	for _, expected := range []string{
+		"# HELP test_prometheus_count_total Test.Prometheus.Count\n# TYPE test_prometheus_count_total counter\ntest_prometheus_count_total 3\n",
+		"# HELP test_prometheus_gauge Test.Prometheus.Gauge\n# TYPE test_prometheus_gauge gauge\ntest_prometheus_gauge -2\n",
+		"# TYPE test_prometheus_latency summary\ntest_prometheus_latency{quantile=\"0.5\"} 10\ntest_prometheus_latency{quantile=\"0.999\"} 100\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Missing\n%s\nfrom\n%s", expected, body)
+		}
+	}
+
+	if strings.Contains(body, "# EOF") {
+		t.Error("The text format doesn't have an EOF marker")
+	}
+}
+
+func TestOpenMetrics(t *testing.T) {
+	metrics.Counter("Test.OpenMetrics.Count").Add()
+
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;q=0.5")
+	w := httptest.NewRecorder()
+	Prometheus().ServeHTTP(w, r)
+
+	if v := w.Header().Get("Content-Type"); v != openMetricsContentType {
+		t.Errorf("Content-Type was %q", v)
+	}
+
+	body := w.Body.String()
+	expected := "# HELP test_openmetrics_count Test.OpenMetrics.Count\n# TYPE test_openmetrics_count counter\ntest_openmetrics_count_total 1\n"
+	if !strings.Contains(body, expected) {
+		t.Errorf("Missing\n%s\nfrom\n%s", expected, body)
+	}
+
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Error("Missing EOF marker")
+	}
+}
+
+func TestPrometheusCollisions(t *testing.T) {
+	metrics.Counter("Test.Collisions.GET /users/:id.Responses").Add()
+	metrics.Counter("Test.Collisions.GET /users/{id}.Responses").AddN(2)
+	metrics.Counter("Test.Collisions.Latency").Add()
+	metrics.Gauge("Test.Collisions.Latency.P50").Set(10)
+
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	Prometheus().ServeHTTP(w, r)
+
+	body := w.Body.String()
+	for name, expected := range map[string]int{
+		"# TYPE test_collisions_get_users_id_responses_total ": 1,
+		"test_collisions_get_users_id_responses_total 1\n":     1,
+		"# TYPE test_collisions_latency_total counter\n":       1,
+		"# TYPE test_collisions_latency_p50 gauge\n":           1,
+		"# TYPE test_collisions_latency summary\n":             0,
+	} {
+		if n := strings.Count(body, name); n != expected {
+			t.Errorf("%q appeared %d times, but expected %d", name, n, expected)
+		}
+	}
+
+	_, gauges := metrics.Snapshot()
+	if n := gauges["Prometheus.Collisions"]; n != 1 {
+		t.Errorf("Found %d collisions, but expected 1", n)
+	}
+
+	// A second scrape reports the same collisions rather than adding to them.
+	Prometheus().ServeHTTP(httptest.NewRecorder(), r)
+
+	_, gauges = metrics.Snapshot()
+	if n := gauges["Prometheus.Collisions"]; n != 1 {
+		t.Errorf("Found %d collisions on the second scrape, but expected 1", n)
+	}
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/codahale/metrics"
+)
+
+const (
+	windowSlots = 60
+	windowSlot  = 5 * time.Second // a five-minute window, like the histograms
+)
+
+// errorWindow counts responses and server errors over a sliding five-minute
+// window.
+type errorWindow struct {
+	clock func() time.Time
+
+	m      sync.Mutex
+	slots  [windowSlots]int64 // the index of the slot each count is for
+	total  [windowSlots]uint64
+	errors [windowSlots]uint64
+}
+
+func newErrorWindow() *errorWindow {
+	return &errorWindow{clock: time.Now}
+}
+
+// add counts a response, and whether it was a server error.
+func (w *errorWindow) add(serverError bool) {
+	slot := w.clock().UnixNano() / int64(windowSlot)
+	i := slot % windowSlots
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.slots[i] != slot {
+		w.slots[i] = slot
+		w.total[i] = 0
+		w.errors[i] = 0
+	}
+	w.total[i]++
+	if serverError {
+		w.errors[i]++
+	}
+}
+
+// perMille returns the fraction of responses in the window which were server
+// errors, in thousandths, or zero if there were no responses.
+func (w *errorWindow) perMille() int64 {
+	oldest := w.clock().UnixNano()/int64(windowSlot) - windowSlots
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	var total, errors uint64
+	for i, slot := range w.slots {
+		if slot > oldest {
+			total += w.total[i]
+			errors += w.errors[i]
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return int64(errors * 1000 / total)
+}
+
+var (
+	wm      sync.Mutex
+	windows = make(map[string]*errorWindow)
+)
+
+// errorRatio returns the error window published as the gauge with the given
+// name, creating it if need be, so that recorders with the same prefix share
+// it.
+func errorRatio(name string) *errorWindow {
+	wm.Lock()
+	defer wm.Unlock()
+
+	w, ok := windows[name]
+	if !ok {
+		w = newErrorWindow()
+		metrics.Gauge(name).SetFunc(w.perMille)
+		windows[name] = w
+	}
+	return w
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorWindow(t *testing.T) {
+	now := time.Date(2014, 6, 3, 16, 45, 22, 0, time.UTC)
+	w := newErrorWindow()
+	w.clock = func() time.Time { return now }
+
+	if v := w.perMille(); v != 0 {
+		t.Errorf("Ratio of no responses was %d, but expected 0", v)
+	}
+
+	w.add(true)
+	for i := 0; i < 3; i++ {
+		w.add(false)
+	}
+
+	now = now.Add(time.Minute)
+	w.add(true)
+	for i := 0; i < 3; i++ {
+		w.add(false)
+	}
+
+	if v := w.perMille(); v != 250 {
+		t.Errorf("Ratio was %d, but expected 250", v)
+	}
+
+	// The first minute's responses fall out of the window.
+	now = now.Add(4*time.Minute + 30*time.Second)
+	w.add(true)
+	w.add(true)
+
+	if v := w.perMille(); v != 500 {
+		t.Errorf("Ratio was %d, but expected 500", v)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if v := w.perMille(); v != 0 {
+		t.Errorf("Ratio after the window was %d, but expected 0", v)
+	}
+}
@@ -5,7 +5,10 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -21,25 +24,80 @@ import (
 
 // Service is an HTTP service.
 type Service struct {
-	h *logging.LoggingHandler
+	h        *logging.LoggingHandler
+	log      io.Writer
+	closeLog io.Closer // the log, if the service owns it
+	logOpts  []logging.Option
 }
 
 func (s Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.h.ServeHTTP(w, r)
 }
 
-// Close stops the service.
+// Close stops the service, waiting for the request log to be written.
 func (s Service) Close() error {
-	s.h.Stop()
-	return nil
+	return s.Shutdown(context.Background())
+}
+
+// Shutdown stops the service, waiting for the request log to be written until
+// the context is done. A log passed to LogToCloser is closed either way.
+func (s Service) Shutdown(ctx context.Context) error {
+	var err error
+	if n, serr := s.h.Stop(ctx); serr != nil {
+		err = fmt.Errorf("service: lost %d log lines: %w", n, serr)
+	}
+
+	if s.closeLog != nil {
+		err = errors.Join(err, s.closeLog.Close())
+	}
+	return err
+}
+
+// An Option configures a Service.
+type Option func(*Service)
+
+// LogTo returns an Option which writes the request log to the given Writer
+// instead of os.Stdout. The Writer is left open when the service is closed.
+func LogTo(w io.Writer) Option {
+	return func(s *Service) {
+		s.log = w
+		s.closeLog = nil
+	}
+}
+
+// LogToCloser returns an Option which writes the request log to the given
+// WriteCloser, such as a logging.RotatingFile, and closes it when the service
+// is closed.
+func LogToCloser(w io.WriteCloser) Option {
+	return func(s *Service) {
+		s.log = w
+		s.closeLog = w
+	}
+}
+
+// LogOptions returns an Option which configures the request log, e.g. to trust
+// the X-Forwarded-For header set by a load balancer:
+//
+//	service.New(h, recovery.LogOnPanic, service.LogOptions(
+//		logging.WithClientIP(clientip.MustResolver(clientip.XForwardedFor, "10.0.0.0/8")),
+//	))
+func LogOptions(opts ...logging.Option) Option {
+	return func(s *Service) {
+		s.logOpts = append(s.logOpts, opts...)
+	}
 }
 
 // New returns a new service-ready handler given an application handler.
 //
 // This stack application-level metrics, debug endpoints, panic recovery, and
 // request logging, in that order.
-func New(h http.Handler, onPanic recovery.PanicHandler) Service {
-	l := logging.Wrap(
+func New(h http.Handler, onPanic recovery.PanicHandler, opts ...Option) Service {
+	s := Service{log: os.Stdout}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	s.h = logging.Wrap(
 		recovery.Wrap(
 			debug.Wrap(
 				metrics.Wrap(
@@ -48,14 +106,15 @@ func New(h http.Handler, onPanic recovery.PanicHandler) Service {
 			),
 			onPanic,
 		),
-		os.Stdout,
+		s.log,
+		s.logOpts...,
 	)
-	l.Start()
-	return Service{h: l}
+	s.h.Start()
+	return s
 }
 
 func init() {
-	dump := make(chan os.Signal)
+	dump := make(chan os.Signal, 1)
 	go func() {
 		stack := make([]byte, 16*1024)
 		for _ = range dump {
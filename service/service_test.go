@@ -1 +1,109 @@
 package service
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codahale/http-handlers/logging"
+	"github.com/codahale/http-handlers/recovery"
+)
+
+func openLog(t *testing.T) (*logging.RotatingFile, string) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := logging.OpenRotatingFile(path, logging.RotationPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rf, path
+}
+
+func TestLogToCloser(t *testing.T) {
+	rf, path := openLog(t)
+
+	s := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}), recovery.LogOnPanic, LogToCloser(rf))
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(b), `"GET /missing HTTP/1.1" 404`) {
+		t.Errorf("Log was %q", b)
+	}
+
+	if _, err := rf.Write([]byte("late\n")); err != os.ErrClosed {
+		t.Errorf("The log wasn't closed: %v", err)
+	}
+}
+
+// stuckLog is a log writer which blocks until it's closed.
+type stuckLog struct {
+	closed chan struct{}
+}
+
+func (l *stuckLog) Write(b []byte) (int, error) {
+	<-l.closed
+	return 0, os.ErrClosed
+}
+
+func (l *stuckLog) Close() error {
+	close(l.closed)
+	return nil
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	log := &stuckLog{closed: make(chan struct{})}
+	s := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		recovery.LogOnPanic, LogToCloser(log))
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown returned %v, but expected a timeout", err)
+	}
+
+	select {
+	case <-log.closed:
+	default:
+		t.Error("The log wasn't closed")
+	}
+}
+
+func TestLogToLeavesOpen(t *testing.T) {
+	rf, path := openLog(t)
+	defer rf.Close()
+
+	s := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		recovery.LogOnPanic, LogTo(rf))
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rf.Write([]byte("mine\n")); err != nil {
+		t.Errorf("The log was closed: %v", err)
+	}
+
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "mine\n" {
+		t.Errorf("Log was %q (%v)", b, err)
+	}
+}